@@ -0,0 +1,63 @@
+package framework
+
+import "net/http"
+
+// 把标准库的中间件转换成ControllerHandler，可以直接用于Core.Use和Group.Use
+// 中间件传给下一个handler的*http.Request和ResponseWriter会设置到Context中，后面的handler都能看到
+// 中间件没有调用下一个handler时，后面的handler不会执行
+func WrapHttpMiddleware(middleware func(http.Handler) http.Handler) ControllerHandler {
+	return func(c *Context) error {
+		req, res := c.req, c.res
+		//中间件返回后恢复原来的请求和响应，包装过的ResponseWriter只在中间件内有效
+		defer func() {
+			c.req, c.res = req, res
+		}()
+
+		var err error
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			c.SetRequest(r)
+			c.SetResponse(w)
+			err = c.Next()
+			//中间件可能在返回前读取状态码，只设置了状态码的响应要先写入
+			c.res.WriteHeaderNow()
+		})
+		middleware(next).ServeHTTP(res, req)
+		if !called {
+			c.Abort()
+		}
+		return err
+	}
+}
+
+// 把标准库的http.Handler转换成ControllerHandler，作为路由最后的处理函数
+func WrapHttpHandler(handler http.Handler) ControllerHandler {
+	return func(c *Context) error {
+		handler.ServeHTTP(c.res, c.req)
+		return nil
+	}
+}
+
+// 把标准库的http.HandlerFunc转换成ControllerHandler
+func WrapHttpHandlerFunc(handler http.HandlerFunc) ControllerHandler {
+	return WrapHttpHandler(handler)
+}
+
+// 把ControllerHandler转换成标准库的中间件，如把middlewares.Recovery()用在标准库的handler链条中
+// handler中调用Next会执行下一个http.Handler
+func ToHttpMiddleware(handler ControllerHandler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := NewContext(w, r)
+			ctx.SetHandlers([]ControllerHandler{handler, func(c *Context) error {
+				next.ServeHTTP(c.res, c.req)
+				return nil
+			}})
+			if err := ctx.Next(); err != nil {
+				ctx.handleError(err)
+			}
+			ctx.res.WriteHeaderNow()
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type adapterKey struct{}
+
+// 记录状态码和写入字节数的标准库ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (this *statusRecorder) WriteHeader(code int) {
+	this.status = code
+	this.ResponseWriter.WriteHeader(code)
+}
+
+func (this *statusRecorder) Write(b []byte) (int, error) {
+	n, err := this.ResponseWriter.Write(b)
+	this.size += n
+	return n, err
+}
+
+// 标准库中间件替换的请求和响应后面的handler都能看到，中间件返回后恢复
+func TestWrapHttpMiddleware(t *testing.T) {
+	core := NewCore()
+	var status, size int
+	var restored bool
+	core.Use(func(c *Context) error {
+		req := c.GetRequest()
+		err := c.Next()
+		restored = c.GetRequest() == req
+		return err
+	})
+	core.Use(WrapHttpMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), adapterKey{}, "std")))
+			status, size = rec.status, rec.size
+		})
+	}))
+	core.Get("/users", func(c *Context) error {
+		if _, ok := c.GetResponse().Unwrap().(*statusRecorder); !ok {
+			t.Errorf("response %T does not wrap the middleware's writer", c.GetResponse().Unwrap())
+		}
+		val, _ := c.GetRequest().Context().Value(adapterKey{}).(string)
+		c.Text(val).SetStatus(http.StatusCreated)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "std" {
+		t.Errorf("response = %d %q, want 201 std", w.Code, w.Body.String())
+	}
+	if status != http.StatusCreated || size != 3 {
+		t.Errorf("middleware saw %d %dB, want 201 3B", status, size)
+	}
+	if !restored {
+		t.Errorf("request is not restored after the middleware returns")
+	}
+}
+
+// 标准库中间件没有调用next时中止链条
+func TestWrapHttpMiddlewareAbort(t *testing.T) {
+	core := NewCore()
+	core.Use(WrapHttpMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}))
+	ran := false
+	core.Get("/secret", func(c *Context) error {
+		ran = true
+		c.Text("secret")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/secret", nil))
+	if w.Code != http.StatusUnauthorized || ran {
+		t.Errorf("code = %d, handler ran = %v, want 401 and not run", w.Code, ran)
+	}
+
+	ran = false
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+	req.Header.Set("Authorization", "token")
+	core.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !ran || w.Body.String() != "secret" {
+		t.Errorf("authorized = %d %q, handler ran = %v", w.Code, w.Body.String(), ran)
+	}
+}
+
+func TestWrapHttpHandler(t *testing.T) {
+	core := NewCore()
+	core.Get("/std/:id", WrapHttpHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/std/1", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "/std/1" {
+		t.Errorf("response = %d %q, want 202 /std/1", w.Code, w.Body.String())
+	}
+}
+
+// ControllerHandler用在标准库的链条中，调用Next执行下一个http.Handler，返回的错误交给错误处理函数
+func TestToHttpMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	tests := []struct {
+		name    string
+		handler ControllerHandler
+		code    int
+		header  string
+		body    string
+	}{
+		{"next", func(c *Context) error {
+			c.SetHeader("X-Mw", "1")
+			return c.Next()
+		}, 200, "1", "next"},
+		{"error", func(c *Context) error {
+			return NewHTTPError(http.StatusForbidden)
+		}, 403, "", ""},
+		{"abort", func(c *Context) error {
+			c.AbortWithStatus(http.StatusNoContent)
+			return nil
+		}, 204, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ToHttpMiddleware(tt.handler)(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.code || w.Header().Get("X-Mw") != tt.header {
+			t.Errorf("%s: code = %d, X-Mw = %q, want %d %q", tt.name, w.Code, w.Header().Get("X-Mw"), tt.code, tt.header)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body.String(), tt.body)
+		}
+		if tt.body == "" && w.Body.String() == "next" {
+			t.Errorf("%s: next handler ran", tt.name)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package framework
+
+import (
+	"encoding"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 绑定失败的错误，记录出错的字段和值，json和xml的body解析失败时只有Source和Err
+type BindError struct {
+	Source string //数据来源，如 uri、query、form、header、cookie、json、xml
+	Key    string //tag中的参数名
+	Field  string //结构体字段，嵌套的结构体用.连接，如 Filter.Page
+	Value  string //无法转换的值
+	Err    error
+}
+
+func (this *BindError) Error() string {
+	if this.Key == "" {
+		return "bind " + this.Source + ": " + this.Err.Error()
+	}
+	return "bind " + this.Source + " " + this.Key + " to " + this.Field + ": " + this.Err.Error()
+}
+
+func (this *BindError) Unwrap() error {
+	return this.Err
+}
+
+// 绑定的数据来源，tag为结构体字段上的tag名称
+type bindSource struct {
+	tag    string
+	lookup func(key string) ([]string, bool)
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// 从路由参数、查询参数、表单、头信息和cookie中绑定结构体，字段通过tag指定来源和参数名，如
+//
+//	type ListReq struct {
+//		Id     int       `uri:"id"`
+//		Page   int       `query:"page" default:"1"`
+//		Tags   []string  `query:"tag"`
+//		Name   *string   `form:"name"`
+//		Token  string    `header:"X-Token"`
+//		Sid    string    `cookie:"sid"`
+//		Since  time.Time `query:"since" time_format:"2006-01-02"`
+//		Filter Filter    //没有tag的结构体字段会递归绑定
+//	}
+//
+// 一个字段有多个来源时按uri、query、form、header、cookie的顺序取第一个有值的，非字符串字段的空值当作没有值
+// 值无法转换时返回400的HTTPError，原因为*BindError；绑定后按validate tag校验，见Validate
+func (c *Context) Bind(obj interface{}) error {
+	return c.bindWith(obj, c.uriSource(), c.querySource(), c.formSource(), c.headerSource(), c.cookieSource())
+}
+
+// 只绑定uri tag，即路由中的参数
+func (c *Context) BindUri(obj interface{}) error {
+	return c.bindWith(obj, c.uriSource())
+}
+
+// 只绑定query tag，即URL中的参数
+func (c *Context) BindQuery(obj interface{}) error {
+	return c.bindWith(obj, c.querySource())
+}
+
+// 只绑定form tag，即表单中的参数，包括multipart表单
+func (c *Context) BindForm(obj interface{}) error {
+	return c.bindWith(obj, c.formSource())
+}
+
+// 只绑定header tag
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.bindWith(obj, c.headerSource())
+}
+
+// 只绑定cookie tag
+func (c *Context) BindCookie(obj interface{}) error {
+	return c.bindWith(obj, c.cookieSource())
+}
+
+func (c *Context) bindWith(obj interface{}, sources ...bindSource) error {
+	if c.req == nil {
+		return errors.New("request empty")
+	}
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: obj must be a non-nil pointer to struct")
+	}
+
+	if _, err := bindStruct(rv.Elem(), "", sources, nil); err != nil {
+		var be *BindError
+		if errors.As(err, &be) {
+			return NewHTTPError(http.StatusBadRequest, "invalid "+be.Source+" param "+be.Key).WithInternal(be)
+		}
+		return err
+	}
+	return validateBound(obj)
+}
+
+func (c *Context) uriSource() bindSource {
+	return bindSource{tag: "uri", lookup: func(key string) ([]string, bool) {
+		val, ok := c.params.Get(key)
+		return []string{val}, ok
+	}}
+}
+
+func (c *Context) querySource() bindSource {
+	query := c.req.URL.Query()
+	return bindSource{tag: "query", lookup: func(key string) ([]string, bool) {
+		val, ok := query[key]
+		return val, ok
+	}}
+}
+
+func (c *Context) formSource() bindSource {
+	//不是multipart表单时ParseMultipartForm会返回错误，但普通表单已经解析好了
+	if c.req.MultipartForm == nil {
+		c.req.ParseMultipartForm(defaultMultipartMemory)
+	}
+	return bindSource{tag: "form", lookup: func(key string) ([]string, bool) {
+		val, ok := c.req.PostForm[key]
+		return val, ok
+	}}
+}
+
+func (c *Context) headerSource() bindSource {
+	return bindSource{tag: "header", lookup: func(key string) ([]string, bool) {
+		val := c.req.Header.Values(key)
+		return val, len(val) > 0
+	}}
+}
+
+func (c *Context) cookieSource() bindSource {
+	return bindSource{tag: "cookie", lookup: func(key string) ([]string, bool) {
+		cookie, err := c.req.Cookie(key)
+		if err != nil {
+			return nil, false
+		}
+		return []string{cookie.Value}, true
+	}}
+}
+
+// 绑定结构体的每个字段，返回是否有字段被设置，stack为外层正在绑定的结构体类型
+func bindStruct(v reflect.Value, prefix string, sources []bindSource, stack []reflect.Type) (bool, error) {
+	t := v.Type()
+	stack = append(stack, t)
+	bound := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		tagged := false
+		set := false
+		for _, source := range sources {
+			key, ok := field.Tag.Lookup(source.tag)
+			if !ok || key == "-" {
+				continue
+			}
+			if key == "" {
+				key = field.Name
+			}
+			tagged = true
+
+			values, ok := source.lookup(key)
+			if !ok || len(values) == 0 || isEmptyValue(field.Type, values) {
+				continue
+			}
+			if err := setField(fv, field, values); err != nil {
+				return bound, &BindError{Source: source.tag, Key: key, Field: prefix + field.Name, Value: strings.Join(values, ","), Err: err}
+			}
+			set = true
+			break
+		}
+
+		//有tag但是所有来源都没有值时使用默认值
+		if tagged && !set {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				if err := setField(fv, field, []string{def}); err != nil {
+					return bound, &BindError{Source: "default", Key: field.Name, Field: prefix + field.Name, Value: def, Err: err}
+				}
+				set = true
+			}
+		}
+		if tagged {
+			bound = bound || set
+			continue
+		}
+
+		//没有tag的结构体字段，递归绑定
+		ok, err := bindNested(fv, prefix+field.Name+".", sources, stack)
+		if err != nil {
+			return bound, err
+		}
+		bound = bound || ok
+	}
+	return bound, nil
+}
+
+// 递归绑定嵌套的结构体，结构体指针只有在有字段被设置时才会赋值
+// 指向外层结构体类型的指针不再绑定，如 type Cat struct{ Parent *Cat }，否则会无限递归
+func bindNested(v reflect.Value, prefix string, sources []bindSource, stack []reflect.Type) (bool, error) {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		if !isNestedStruct(t.Elem()) || inTypeStack(stack, t.Elem()) {
+			return false, nil
+		}
+		elem := reflect.New(t.Elem())
+		if !v.IsNil() {
+			elem = v
+		}
+		ok, err := bindStruct(elem.Elem(), prefix, sources, stack)
+		if ok {
+			v.Set(elem)
+		}
+		return ok, err
+	}
+	if !isNestedStruct(t) {
+		return false, nil
+	}
+	return bindStruct(v, prefix, sources, stack)
+}
+
+func inTypeStack(stack []reflect.Type, t reflect.Type) bool {
+	for _, st := range stack {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
+
+// 非字符串字段的值都为空时当作没有传，如 ?page= 会使用默认值
+func isEmptyValue(t reflect.Type, values []string) bool {
+	for _, val := range values {
+		if val != "" {
+			return false
+		}
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.String
+}
+
+// 是否是需要递归绑定的结构体，time.Time和实现了TextUnmarshaler的类型当作单个值
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// 设置字段的值，切片使用所有的值，其他类型使用最后一个值
+func setField(v reflect.Value, field reflect.StructField, values []string) error {
+	if v.Kind() == reflect.Slice && !reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, val := range values {
+			if err := setValue(slice.Index(i), field, val); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, field, values[len(values)-1])
+}
+
+func setValue(v reflect.Value, field reflect.StructField, val string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), field, val); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		return setTime(v, field, val)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(val))
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(val)
+		return nil
+	}
+
+	//空值保持零值
+	if val == "" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// 解析时间，time_format指定格式，默认为RFC3339，unix和unixmilli表示时间戳
+// time_location指定时区，默认为本地时区
+func setTime(v reflect.Value, field reflect.StructField, val string) error {
+	if val == "" {
+		return nil
+	}
+
+	format := field.Tag.Get("time_format")
+	switch format {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		t := time.Unix(n, 0)
+		if format == "unixmilli" {
+			t = time.UnixMilli(n)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case "":
+		format = time.RFC3339
+	}
+
+	loc := time.Local
+	if name := field.Tag.Get("time_location"); name != "" {
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return err
+		}
+		loc = l
+	}
+	t, err := time.ParseInLocation(format, val, loc)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
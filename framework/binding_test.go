@@ -0,0 +1,196 @@
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindCat struct {
+	Name   string `query:"name"`
+	Parent *bindCat
+	Owner  *bindOwner
+}
+
+type bindOwner struct {
+	Name string `query:"owner"`
+	Cat  *bindCat
+}
+
+// 指向外层结构体类型的指针不能无限递归，其他的结构体指针照常绑定
+func TestBindRecursiveStruct(t *testing.T) {
+	c := NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?name=tom&owner=bob", nil))
+
+	var cat bindCat
+	if err := c.BindQuery(&cat); err != nil {
+		t.Fatal(err)
+	}
+	if cat.Name != "tom" || cat.Parent != nil {
+		t.Errorf("cat = %+v, want name tom and nil parent", cat)
+	}
+	if cat.Owner == nil || cat.Owner.Name != "bob" || cat.Owner.Cat != nil {
+		t.Errorf("owner = %+v, want name bob and nil cat", cat.Owner)
+	}
+}
+
+// 实现了TextUnmarshaler的类型当作单个值
+type bindLevel int
+
+func (this *bindLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*this = 1
+	case "high":
+		*this = 2
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+type bindFilter struct {
+	Q string `query:"q"`
+}
+
+type bindReq struct {
+	Id     int           `uri:"id"`
+	Page   int           `query:"page" default:"1"`
+	Size   *int          `query:"size"`
+	Tags   []string      `query:"tag"`
+	Nums   []int         `query:"n"`
+	Name   string        `query:"name" form:"name"`
+	Token  string        `header:"X-Token"`
+	Langs  []string      `header:"Accept-Language"`
+	Sid    string        `cookie:"sid"`
+	Since  time.Time     `query:"since" time_format:"2006-01-02" time_location:"UTC"`
+	At     time.Time     `query:"at" time_format:"unix"`
+	Wait   time.Duration `query:"wait"`
+	Level  bindLevel     `query:"level"`
+	Active bool          `query:"active"`
+	Ratio  float64       `query:"ratio"`
+	Filter bindFilter
+	Skip   string `query:"-"`
+}
+
+// 在路由中绑定，返回绑定的结果和错误
+func bindRequest(req *http.Request) (bindReq, error) {
+	core := NewCore()
+	var obj bindReq
+	var err error
+	core.Any("/items/:id", func(c *Context) error {
+		err = c.Bind(&obj)
+		return nil
+	})
+	core.ServeHTTP(httptest.NewRecorder(), req)
+	return obj, err
+}
+
+func TestBind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items/7?size=20&tag=a&tag=b&n=1&n=2&name=query&since=2024-05-01&at=1700000000&wait=1m30s&level=high&active=true&ratio=0.5&q=go&Skip=x", nil)
+	req.Header.Set("X-Token", "abc")
+	req.Header.Add("Accept-Language", "en")
+	req.Header.Add("Accept-Language", "zh")
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+
+	obj, err := bindRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Id != 7 || obj.Page != 1 || obj.Size == nil || *obj.Size != 20 {
+		t.Errorf("id/page/size = %d %d %v", obj.Id, obj.Page, obj.Size)
+	}
+	if !reflect.DeepEqual(obj.Tags, []string{"a", "b"}) || !reflect.DeepEqual(obj.Nums, []int{1, 2}) {
+		t.Errorf("slices = %v %v", obj.Tags, obj.Nums)
+	}
+	if obj.Name != "query" || obj.Token != "abc" || obj.Sid != "s1" || !reflect.DeepEqual(obj.Langs, []string{"en", "zh"}) {
+		t.Errorf("name/token/sid/langs = %q %q %q %v", obj.Name, obj.Token, obj.Sid, obj.Langs)
+	}
+	if !obj.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) || obj.At.Unix() != 1700000000 {
+		t.Errorf("times = %v %v", obj.Since, obj.At)
+	}
+	if obj.Wait != 90*time.Second || obj.Level != 2 || !obj.Active || obj.Ratio != 0.5 {
+		t.Errorf("wait/level/active/ratio = %v %d %v %v", obj.Wait, obj.Level, obj.Active, obj.Ratio)
+	}
+	if obj.Filter.Q != "go" || obj.Skip != "" {
+		t.Errorf("filter/skip = %q %q", obj.Filter.Q, obj.Skip)
+	}
+}
+
+// 非字符串字段的空值当作没有传，使用默认值；字符串字段的空值是有效的值
+func TestBindEmptyValue(t *testing.T) {
+	obj, err := bindRequest(httptest.NewRequest(http.MethodGet, "/items/1?page=&size=&n=&name=&active=", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Page != 1 || obj.Size != nil || obj.Nums != nil || obj.Active {
+		t.Errorf("page/size/nums/active = %d %v %v %v, want defaults", obj.Page, obj.Size, obj.Nums, obj.Active)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "multipart")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"urlencoded", "application/x-www-form-urlencoded", "name=form", "form"},
+		{"multipart", mw.FormDataContentType(), body.String(), "multipart"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/items/1", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		obj, err := bindRequest(req)
+		if err != nil || obj.Name != tt.want {
+			t.Errorf("%s: name = %q, %v, want %q", tt.name, obj.Name, err, tt.want)
+		}
+	}
+
+	//query优先于form
+	req := httptest.NewRequest(http.MethodPost, "/items/1?name=query", strings.NewReader("name=form"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if obj, _ := bindRequest(req); obj.Name != "query" {
+		t.Errorf("name = %q, want query before form", obj.Name)
+	}
+}
+
+// 值无法转换时返回400的HTTPError，原因为*BindError
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		path    string
+		message string
+		source  string
+		field   string
+	}{
+		{"/items/x", "invalid uri param id", "uri", "Id"},
+		{"/items/1?page=x", "invalid query param page", "query", "Page"},
+		{"/items/1?n=1&n=x", "invalid query param n", "query", "Nums"},
+		{"/items/1?since=2024/05/01", "invalid query param since", "query", "Since"},
+		{"/items/1?at=now", "invalid query param at", "query", "At"},
+		{"/items/1?wait=5x", "invalid query param wait", "query", "Wait"},
+		{"/items/1?level=mid", "invalid query param level", "query", "Level"},
+	}
+	for _, tt := range tests {
+		_, err := bindRequest(httptest.NewRequest(http.MethodGet, tt.path, nil))
+		he := AsHTTPError(err)
+		if err == nil || he.Code != http.StatusBadRequest || he.Message != tt.message {
+			t.Errorf("%s: err = %v, want 400 %s", tt.path, err, tt.message)
+			continue
+		}
+		var be *BindError
+		if !errors.As(err, &be) || be.Source != tt.source || be.Field != tt.field {
+			t.Errorf("%s: bind error = %+v, want %s %s", tt.path, be, tt.source, tt.field)
+		}
+	}
+}
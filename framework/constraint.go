@@ -0,0 +1,115 @@
+package framework
+
+import (
+	"errors"
+	"regexp"
+)
+
+// 内置的参数约束，其他约束按正则表达式处理
+var paramConstraints = map[string]func(string) bool{
+	"int":   isInt,
+	"uint":  isUint,
+	"alpha": isAlpha,
+	"alnum": isAlnum,
+	"uuid":  isUUID,
+}
+
+// 能匹配相同值的内置约束，同一层的参数使用它们时会冲突
+var overlapConstraints = map[[2]string]bool{
+	{"int", "uint"}:    true,
+	{"int", "alnum"}:   true,
+	{"uint", "alnum"}:  true,
+	{"alpha", "alnum"}: true,
+}
+
+// 判断两个约束是否会匹配相同的值，正则和自定义的约束无法判断，按注册顺序匹配
+func constraintsOverlap(a, b string) bool {
+	return a == b || overlapConstraints[[2]string{a, b}] || overlapConstraints[[2]string{b, a}]
+}
+
+// 注册自定义的参数约束，注册名为hex的约束后可以在路由中使用 :id<hex>
+// 需要在注册路由之前调用
+func RegisterParamConstraint(name string, check func(string) bool) {
+	paramConstraints[name] = check
+}
+
+// 把约束编译成检查函数，没有约束时返回nil
+func compileConstraint(constraint string) (func(string) bool, error) {
+	if constraint == "" {
+		return nil, nil
+	}
+	if check, ok := paramConstraints[constraint]; ok {
+		return check, nil
+	}
+	//正则约束需要匹配整个参数值
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		return nil, errors.New("invalid param constraint <" + constraint + ">")
+	}
+	return re.MatchString, nil
+}
+
+func isInt(s string) bool {
+	if len(s) > 0 && s[0] == '-' {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isUint(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isAlpha(s[i:i+1]) && !isUint(s[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 格式为 8-4-4-4-12 的十六进制
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			c := s[i] | 0x20
+			if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
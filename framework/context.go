@@ -3,30 +3,103 @@ package framework
 import (
 	"context"
 	"net/http"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Context struct {
-	res          http.ResponseWriter
+	core         *Core          //处理当前请求的Core
+	res          ResponseWriter //当前的响应，一般是writer，可以被SetResponse替换
+	writer       responseWriter //包装原始响应的writer，随context一起复用
 	req          *http.Request
 	resLock      *sync.RWMutex       //控制res的锁
 	isTimeout    bool                //是否超时
 	handlers     []ControllerHandler //当前请求的handler链条
 	handlerIndex int                 //当前链条在哪个节点
-	params       map[string]string   //uri参数
+	isAborted    atomic.Bool         //是否已经中止handler链条，超时后业务逻辑的goroutine和外层的链条都会读取
+	handledErr   error               //已经交给错误处理函数的错误，向外层传递时不会重复处理
+	params       Params              //uri参数
+	keys         map[string]any      //请求范围内的数据，在handler之间传递
+	keysLock     sync.RWMutex        //控制keys的锁
 }
 
 func NewContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		res:          w,
+	ctx := &Context{
 		req:          r,
 		resLock:      &sync.RWMutex{},
 		isTimeout:    false,
 		handlers:     []ControllerHandler{},
 		handlerIndex: -1,
-		params:       map[string]string{},
+		params:       Params{},
 	}
+	ctx.writer.reset(w)
+	ctx.res = &ctx.writer
+	return ctx
+}
+
+// 重置context，以便从池中取出后处理新的请求
+func (this *Context) reset(w http.ResponseWriter, r *http.Request, maxParams int) {
+	this.writer.reset(w)
+	this.res = &this.writer
+	this.req = r
+	this.isTimeout = false
+	this.handlers = nil
+	this.handlerIndex = -1
+	this.isAborted.Store(false)
+	this.handledErr = nil
+	if cap(this.params) < maxParams {
+		this.params = make(Params, 0, maxParams)
+	}
+	this.params = this.params[:0]
+
+	this.keysLock.Lock()
+	this.keys = nil
+	this.keysLock.Unlock()
+}
+
+// 复制一份context，在handler中启动的goroutine需要使用context时，必须使用复制的context
+// 原来的context在请求结束后会被放回池中复用，复制的context不会
+// 复制的context保留请求、参数和Set设置的数据，handler链条已经中止，写入的响应会被丢弃，可以用SetResponse设置新的响应
+func (this *Context) Copy() *Context {
+	ctx := &Context{
+		core:         this.core,
+		req:          this.req,
+		resLock:      &sync.RWMutex{},
+		handlerIndex: len(this.handlers),
+		params:       make(Params, len(this.params)),
+	}
+	ctx.isAborted.Store(true)
+	copy(ctx.params, this.params)
+	ctx.writer.reset(discardResponse{header: http.Header{}})
+	ctx.res = &ctx.writer
+
+	this.keysLock.RLock()
+	if this.keys != nil {
+		ctx.keys = make(map[string]any, len(this.keys))
+		for k, v := range this.keys {
+			ctx.keys[k] = v
+		}
+	}
+	this.keysLock.RUnlock()
+	return ctx
+}
+
+// 丢弃所有写入的响应，给复制的context使用
+type discardResponse struct {
+	header http.Header
+}
+
+func (this discardResponse) Header() http.Header {
+	return this.header
+}
+
+func (this discardResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (this discardResponse) WriteHeader(code int) {
 }
 
 func (this *Context) WriterMux() *sync.RWMutex {
@@ -37,14 +110,26 @@ func (this *Context) GetRequest() *http.Request {
 	return this.req
 }
 
-func (this *Context) GetResponse() http.ResponseWriter {
+// 直接使用ResponseWriter时不受超时控制，使用Timeout中间件时应该通过IResponse的方法写入响应
+func (this *Context) GetResponse() ResponseWriter {
 	return this.res
 }
 
+// 替换当前请求，后面的handler会看到新的请求
+func (this *Context) SetRequest(req *http.Request) {
+	this.req = req
+}
+
+// 替换当前响应，后面的handler会写入新的响应
+func (this *Context) SetResponse(res http.ResponseWriter) {
+	this.res = NewResponseWriter(res)
+}
+
 func (this *Context) SetHandlers(handlers []ControllerHandler) {
 	this.handlers = handlers
 }
 
+// 标记超时后IResponse的方法都不再写入响应，需要持有WriterMux的写锁
 func (this *Context) SetIsTimeout() {
 	this.isTimeout = true
 }
@@ -57,20 +142,152 @@ func (this *Context) BaseContext() context.Context {
 	return this.req.Context()
 }
 
+// 依次执行链条中剩余的handler，直到全部执行完、被中止或者返回错误
+// 中间件没有调用Next时，返回后也会继续执行后面的handler
+// handler返回错误后链条就中止了，外层中间件忽略了这个错误，后面的handler也不会执行
 func (this *Context) Next() error {
 	this.handlerIndex++
-	if this.handlerIndex < len(this.handlers) {
+	for this.handlerIndex < len(this.handlers) {
+		if this.isAborted.Load() {
+			return nil
+		}
 		if err := this.handlers[this.handlerIndex](this); err != nil {
+			this.Abort()
+			//在链条内处理错误，外层的中间件返回时已经能看到错误响应的状态码
+			this.handleError(err)
 			return err
 		}
+		//超时中间件中止后业务逻辑还在goroutine中执行后面的handler，不能再修改handlerIndex
+		if this.isAborted.Load() {
+			return nil
+		}
+		this.handlerIndex++
 	}
 	return nil
 }
 
-func (this *Context) SetParams(params map[string]string) {
+// 把handler返回的错误交给Core的错误处理函数，同一个错误向外层传递时只处理一次
+// 外层的中间件返回了另一个错误时，会重新处理
+func (this *Context) handleError(err error) {
+	if sameError(err, this.handledErr) {
+		return
+	}
+	this.handledErr = err
+	this.DiscardBody()
+
+	handler := ErrorHandler(DefaultErrorHandler)
+	if this.core != nil && this.core.errorHandler != nil {
+		handler = this.core.errorHandler
+	}
+	handler(this, err)
+}
+
+// 判断是否是同一个错误，不可比较的错误类型如ValidationErrors比较它们的值
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) {
+		return false
+	}
+	if !t.Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
+
+// 中止handler链条，当前handler返回后，后面的handler都不会执行
+func (this *Context) Abort() {
+	this.isAborted.Store(true)
+}
+
+// 设置状态码并中止handler链条
+func (this *Context) AbortWithStatus(code int) {
+	this.SetStatus(code)
+	this.Abort()
+}
+
+// 中止handler链条，返回带状态码的错误，handler直接返回它即可交给Core的错误处理函数
+// 如 return c.AbortWithError(401, err)
+func (this *Context) AbortWithError(code int, err error) error {
+	this.Abort()
+	return NewHTTPError(code).WithInternal(err)
+}
+
+// 是否已经中止handler链条
+func (this *Context) IsAborted() bool {
+	return this.isAborted.Load()
+}
+
+func (this *Context) SetParams(params Params) {
 	this.params = params
 }
 
+// 保存请求范围内的数据，如当前用户、租户、请求id，后面的handler可以通过Get获取
+func (this *Context) Set(key string, val any) {
+	this.keysLock.Lock()
+	defer this.keysLock.Unlock()
+
+	if this.keys == nil {
+		this.keys = map[string]any{}
+	}
+	this.keys[key] = val
+}
+
+func (this *Context) Get(key string) (any, bool) {
+	this.keysLock.RLock()
+	defer this.keysLock.RUnlock()
+
+	val, ok := this.keys[key]
+	return val, ok
+}
+
+// 获取数据，不存在时panic
+func (this *Context) MustGet(key string) any {
+	if val, ok := this.Get(key); ok {
+		return val
+	}
+	panic("key " + key + " does not exist")
+}
+
+func (this *Context) GetString(key string, def string) (string, bool) {
+	return getOrDefault(this, key, def)
+}
+
+func (this *Context) GetInt(key string, def int) (int, bool) {
+	return getOrDefault(this, key, def)
+}
+
+func (this *Context) GetInt64(key string, def int64) (int64, bool) {
+	return getOrDefault(this, key, def)
+}
+
+func (this *Context) GetBool(key string, def bool) (bool, bool) {
+	return getOrDefault(this, key, def)
+}
+
+// 获取指定类型的数据，不存在或者类型不匹配时返回false，如 user, ok := Get[*User](c, "user")
+func Get[T any](c *Context, key string) (T, bool) {
+	var zero T
+	val, ok := c.Get(key)
+	if !ok {
+		return zero, false
+	}
+	v, ok := val.(T)
+	if !ok {
+		return zero, false
+	}
+	return v, true
+}
+
+func getOrDefault[T any](c *Context, key string, def T) (T, bool) {
+	if v, ok := Get[T](c, key); ok {
+		return v, true
+	}
+	return def, false
+}
+
 // 开始实现context.Context接口
 func (this *Context) Deadline() (deadline time.Time, ok bool) {
 	return this.BaseContext().Deadline()
@@ -84,7 +301,13 @@ func (this *Context) Err() error {
 	return this.BaseContext().Err()
 }
 
+// 字符串类型的key先从Set设置的数据中查找，找不到再从请求的context中查找
 func (this *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if val, ok := this.Get(k); ok {
+			return val
+		}
+	}
 	return this.BaseContext().Value(key)
 }
 
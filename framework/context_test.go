@@ -0,0 +1,178 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 复制的context在请求结束、原context被复用后仍然有效
+func TestContextCopyAfterRelease(t *testing.T) {
+	core := NewCore()
+	var copied *Context
+	core.Get("/users/:id", func(c *Context) error {
+		c.Set("user", c.GetParam("id"))
+		if c.GetParam("id") == "1" {
+			copied = c.Copy()
+		}
+		c.Text("ok")
+		return nil
+	})
+
+	core.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	//后面的请求会复用原来的context
+	for i := 0; i < 10; i++ {
+		core.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+	}
+
+	if id := copied.GetParam("id"); id != "1" {
+		t.Errorf("copied param id = %q, want 1", id)
+	}
+	if user, _ := copied.GetString("user", ""); user != "1" {
+		t.Errorf("copied key user = %q, want 1", user)
+	}
+	if path := copied.GetRequest().URL.Path; path != "/users/1" {
+		t.Errorf("copied request path = %q, want /users/1", path)
+	}
+	//复制的context写入的响应会被丢弃，不会影响其他请求
+	copied.Json("late").SetStatus(http.StatusTeapot)
+	if err := copied.Next(); err != nil {
+		t.Errorf("copied Next = %v, want nil", err)
+	}
+}
+
+// 外层中间件忽略了错误时，返回错误的handler后面的handler也不能执行
+func TestNextStopsAfterError(t *testing.T) {
+	core := NewCore()
+	core.Use(func(c *Context) error {
+		c.Next()
+		return nil
+	})
+	core.Use(func(c *Context) error {
+		return NewHTTPError(http.StatusUnauthorized)
+	})
+	core.Get("/secret", func(c *Context) error {
+		c.Text("SECRET")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/secret", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("code = %d, want 401", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "SECRET") {
+		t.Errorf("body %q contains the output of the protected handler", w.Body.String())
+	}
+}
+
+type ctxKey struct{}
+
+// Set的数据在handler之间传递，按类型获取，Value先查Set的数据再查请求的context
+func TestContextKeys(t *testing.T) {
+	core := NewCore()
+	core.Use(func(c *Context) error {
+		c.Set("user", "tom")
+		c.Set("id", 42)
+		c.Set("admin", true)
+		return c.Next()
+	})
+	core.Get("/", func(c *Context) error {
+		if v, ok := c.GetString("user", ""); !ok || v != "tom" {
+			t.Errorf("GetString(user) = %q, %v", v, ok)
+		}
+		if v, ok := c.GetInt("id", 0); !ok || v != 42 {
+			t.Errorf("GetInt(id) = %d, %v", v, ok)
+		}
+		//类型不匹配或者不存在时返回默认值
+		if v, ok := c.GetInt64("id", -1); ok || v != -1 {
+			t.Errorf("GetInt64(id) = %d, %v, want default", v, ok)
+		}
+		if v, ok := c.GetBool("missing", true); ok || !v {
+			t.Errorf("GetBool(missing) = %v, %v, want default", v, ok)
+		}
+		if v, ok := Get[bool](c, "admin"); !ok || !v {
+			t.Errorf("Get[bool](admin) = %v, %v", v, ok)
+		}
+		if _, ok := Get[string](c, "id"); ok {
+			t.Errorf("Get[string](id) ok, want type mismatch")
+		}
+		if c.MustGet("user") != "tom" {
+			t.Errorf("MustGet(user) = %v", c.MustGet("user"))
+		}
+		//context.Context接口
+		if c.Value("user") != "tom" || c.Value(ctxKey{}) != "req" || c.Value("missing") != nil {
+			t.Errorf("Value = %v %v %v", c.Value("user"), c.Value(ctxKey{}), c.Value("missing"))
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MustGet(missing) did not panic")
+				}
+			}()
+			c.MustGet("missing")
+		}()
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "req"))
+	core.ServeHTTP(httptest.NewRecorder(), req)
+
+	//复用的context不能带着上一个请求的数据
+	core.Get("/next", func(c *Context) error {
+		if _, ok := c.Get("missing"); ok {
+			t.Errorf("key leaked from previous request")
+		}
+		return nil
+	})
+	core.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/next", nil))
+}
+
+// 在handler中启动的goroutine使用Copy后并发读写
+func TestContextKeysConcurrent(t *testing.T) {
+	c := NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set("k", i)
+			c.Get("k")
+			c.Copy()
+		}(i)
+	}
+	wg.Wait()
+	if _, ok := c.GetInt("k", 0); !ok {
+		t.Errorf("key k is not set")
+	}
+}
+
+func BenchmarkContextPool(b *testing.B) {
+	core := NewCore()
+	w := &nopResponseWriter{header: http.Header{}}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx := core.pool.Get().(*Context)
+		ctx.reset(w, r, 4)
+		core.releaseContext(ctx)
+	}
+}
+
+func BenchmarkNewContext(b *testing.B) {
+	w := &nopResponseWriter{header: http.Header{}}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx := NewContext(w, r)
+		ctx.SetParams(make(Params, 0, 4))
+	}
+}
@@ -3,89 +3,450 @@ package framework
 import (
 	"log"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type Core struct {
-	router      map[string]*Tree    `json:"router"`
-	middlewares []ControllerHandler `json:"-"` //中间件处理函数
+	router           map[string]*Tree       //不区分host的路由，按请求方法划分
+	hosts            map[string]*hostRouter //按host精确匹配的路由
+	hostPatterns     []*hostRouter          //带参数的host路由，按注册顺序匹配
+	middlewares      []ControllerHandler    //中间件处理函数
+	maxParams        int                    //所有路由中最多的参数个数，用于预分配参数切片
+	notFound         ControllerHandler      //路由不存在时的处理函数
+	methodNotAllowed ControllerHandler      //路由存在但请求方法不匹配时的处理函数
+	errorHandler     ErrorHandler           //处理handler链条返回的错误
+	legacyErrors     bool                   //内置的错误响应是否使用旧的json字符串格式
+	handleOptions    bool                   //是否自动应答没有注册的OPTIONS请求
+	caseSensitive    bool                   //路由是否区分大小写
+	redirectFixCase  bool                   //不区分大小写时，是否重定向到注册时大小写的路径
+	redirectSlash    bool                   //是否把多了或者少了结尾/的请求重定向到注册的路由
+	redirectFixPath  bool                   //是否把带有多余/、.和..的请求重定向到清理后的路由
+	names            map[string]*Route      //命名的路由
+	routes           []*Route               //按注册顺序保存的所有路由
+	dirty            atomic.Bool            //中间件或者路由有变化，需要重新组合handler链条
+	freezeLock       sync.Mutex             //组合handler链条时的锁
+	pool             sync.Pool              //复用Context，减少每个请求的内存分配
+}
+
+// 匹配所有请求方法的路由使用的方法名，只在对应方法没有匹配的路由时使用，如挂载的http.Handler
+const anyMethod = "*"
+
+// Any注册的请求方法
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodHead,
+	http.MethodOptions,
 }
 
 func NewCore() *Core {
+	core := &Core{
+		router:           newRouter(true),
+		hosts:            map[string]*hostRouter{},
+		caseSensitive:    true,
+		names:            map[string]*Route{},
+		errorHandler:     DefaultErrorHandler,
+		notFound:         NotFoundHandler,
+		methodNotAllowed: MethodNotAllowedHandler,
+	}
+	core.pool.New = func() any {
+		ctx := NewContext(nil, nil)
+		ctx.core = core
+		return ctx
+	}
+	return core
+}
+
+// 结束请求并把context放回池中，超时的context还在被业务逻辑的goroutine使用，不能复用
+func (this *Core) releaseContext(ctx *Context) {
+	if ctx.isTimeout {
+		return
+	}
+	//只设置了状态码没有写入body时，在这里写入响应头
+	ctx.res.WriteHeaderNow()
+	ctx.reset(nil, nil, 0)
+	this.pool.Put(ctx)
+}
+
+// 创建按请求方法划分的路由
+func newRouter(caseSensitive bool) map[string]*Tree {
 	router := map[string]*Tree{}
-	router["GET"] = NewTree()
-	router["POST"] = NewTree()
-	router["PUT"] = NewTree()
-	router["DELETE"] = NewTree()
+	for _, method := range anyMethods {
+		tree := NewTree()
+		tree.ignoreCase = !caseSensitive
+		router[method] = tree
+	}
+	return router
+}
 
-	return &Core{router: router}
+// 默认的404处理函数
+func NotFoundHandler(c *Context) error {
+	c.RenderError(http.StatusNotFound, "not found")
+	return nil
+}
+
+// 自动应答OPTIONS请求的处理函数，Allow头已经由Core设置好
+func OptionsHandler(c *Context) error {
+	c.SetStatus(http.StatusNoContent)
+	return nil
+}
+
+// 默认的405处理函数，Allow头已经由Core设置好
+func MethodNotAllowedHandler(c *Context) error {
+	c.RenderError(http.StatusMethodNotAllowed, "method not allowed")
+	return nil
 }
 
 func (this *Core) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	//封装自定义context
-	ctx := NewContext(w, r)
+	//注册完路由后第一次请求时组合handler链条
+	if this.dirty.Load() {
+		this.Freeze()
+	}
+
+	//从池中取出context，请求结束后放回
+	ctx := this.pool.Get().(*Context)
+	ctx.reset(w, r, this.maxParams)
+	defer this.releaseContext(ctx)
+
+	//先根据host选择路由，host中的参数在路径参数之前
+	router := this.routerFor(r, &ctx.params)
+	hostParams := len(ctx.params)
 
-	//导找路由
-	node := this.FindRouteNode(r)
+	//导找路由，同时解析参数
+	node := this.findNode(router, r.Method, r.URL.Path, &ctx.params)
 	if node == nil {
-		ctx.SetStatus(404).Json("not found")
+		//重定向到结尾/或者清理后的路径能匹配的路由
+		if fixed, ok := this.findRedirectPath(router, r, &ctx.params); ok {
+			this.redirect(ctx, fixed)
+			return
+		}
+
+		handler := this.notFound
+		//其他请求方法下有这个路由，返回405
+		if allow := this.allowedMethods(router, r.URL.Path, &ctx.params); len(allow) > 0 {
+			ctx.SetHeader("Allow", strings.Join(allow, ", "))
+			handler = this.methodNotAllowed
+			if this.handleOptions && r.Method == http.MethodOptions {
+				handler = OptionsHandler
+			}
+		}
+		ctx.SetParams(ctx.params[:hostParams])
+		if err := handler(ctx); err != nil {
+			ctx.handleError(err)
+		}
 		return
 	}
 
-	ctx.SetHandlers(node.handlers)
+	//重定向到注册时大小写的路径，参数保持原样
+	if !this.caseSensitive && this.redirectFixCase {
+		fixed := canonicalPath(node.fullPath, ctx.params)
+		if fixed != r.URL.Path && strings.EqualFold(fixed, r.URL.Path) {
+			this.redirect(ctx, fixed)
+			return
+		}
+	}
 
-	//解析参数
-	params := node.ParseParamsFromEndNode(r.URL.Path)
-	ctx.SetParams(params)
+	ctx.SetHandlers(node.Handlers())
 
+	//链条内返回的错误已经处理过，这里不会重复处理
 	if err := ctx.Next(); err != nil {
-		ctx.SetStatus(500).Json("server error")
-		return
+		ctx.handleError(err)
+	}
+}
+
+// 设置内置的404、405、500、超时和panic响应是否使用旧的json字符串格式，默认使用problem+json
+func (this *Core) SetLegacyErrors(legacy bool) {
+	this.legacyErrors = legacy
+}
+
+// 设置handler返回错误时的处理函数，handler可以返回*HTTPError指定状态码和信息
+// 错误在返回它的handler所在的链条内处理，外层的中间件能看到错误响应的状态码
+func (this *Core) SetErrorHandler(handler ErrorHandler) {
+	this.errorHandler = handler
+}
+
+// 设置路由不存在时的处理函数
+func (this *Core) SetNotFound(handler ControllerHandler) {
+	this.notFound = handler
+}
+
+// 设置请求方法不被允许时的处理函数，调用前响应已带上Allow头
+func (this *Core) SetMethodNotAllowed(handler ControllerHandler) {
+	this.methodNotAllowed = handler
+}
+
+// 设置是否自动应答没有注册的OPTIONS请求，应答中带上Allow头
+func (this *Core) SetHandleOptions(handle bool) {
+	this.handleOptions = handle
+}
+
+// 设置路由是否区分大小写，默认和net/http一样区分
+// 不区分时只影响静态段的匹配，参数的值始终保持请求中的大小写
+func (this *Core) SetCaseSensitive(sensitive bool) {
+	this.caseSensitive = sensitive
+	for _, router := range this.routers() {
+		for _, tree := range router {
+			tree.ignoreCase = !sensitive
+		}
+	}
+}
+
+// 设置不区分大小写时，是否把请求重定向到注册时大小写的路径
+func (this *Core) SetRedirectFixCase(redirect bool) {
+	this.redirectFixCase = redirect
+}
+
+// 重定向到新的路径，保留查询参数，GET和HEAD以外的请求使用308保持请求方法
+func (this *Core) redirect(ctx *Context, path string) {
+	code := http.StatusMovedPermanently
+	if ctx.req.Method != http.MethodGet && ctx.req.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+	if ctx.req.URL.RawQuery != "" {
+		path += "?" + ctx.req.URL.RawQuery
+	}
+	http.Redirect(ctx.res, ctx.req, path, code)
+}
+
+// 设置是否把多了或者少了结尾/的请求重定向到注册的路由，如 /aaa/bbb/ 重定向到 /aaa/bbb
+func (this *Core) SetRedirectTrailingSlash(redirect bool) {
+	this.redirectSlash = redirect
+}
+
+// 设置是否把带有多余/、.和..的请求重定向到清理后的路由，如 //aaa/./bbb 重定向到 /aaa/bbb
+func (this *Core) SetRedirectFixedPath(redirect bool) {
+	this.redirectFixPath = redirect
+}
+
+// 查找可以重定向到的路径，没有找到时返回false
+func (this *Core) findRedirectPath(router map[string]*Tree, req *http.Request, params *Params) (string, bool) {
+	path := req.URL.Path
+	if req.Method == http.MethodConnect || path == "/" {
+		return "", false
+	}
+
+	if this.redirectSlash {
+		if fixed, ok := this.matchRedirectPath(router, req.Method, toggleTrailingSlash(path), params); ok {
+			return fixed, true
+		}
+	}
+
+	if this.redirectFixPath {
+		cleaned := CleanPath(path)
+		if cleaned != path {
+			if fixed, ok := this.matchRedirectPath(router, req.Method, cleaned, params); ok {
+				return fixed, true
+			}
+			if this.redirectSlash && cleaned != "/" {
+				if fixed, ok := this.matchRedirectPath(router, req.Method, toggleTrailingSlash(cleaned), params); ok {
+					return fixed, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// 判断path能否匹配路由，能匹配时返回需要重定向到的路径
+func (this *Core) matchRedirectPath(router map[string]*Tree, method string, path string, params *Params) (string, bool) {
+	mark := len(*params)
+	defer func() { *params = (*params)[:mark] }()
+
+	node := this.findNode(router, method, path, params)
+	if node == nil {
+		return "", false
+	}
+	if !this.caseSensitive && this.redirectFixCase {
+		path = canonicalPath(node.fullPath, *params)
+	}
+	return path, true
+}
+
+func toggleTrailingSlash(path string) string {
+	if strings.HasSuffix(path, "/") {
+		return path[:len(path)-1]
 	}
+	return path + "/"
 }
 
+// 添加全局中间件，对之前和之后注册的路由都生效
 func (this *Core) Use(middlewares ...ControllerHandler) {
+	this.freezeLock.Lock()
+	defer this.freezeLock.Unlock()
+
 	this.middlewares = append(this.middlewares, middlewares...)
+	this.dirty.Store(true)
 }
 
-func (this *Core) Get(url string, handlers ...ControllerHandler) {
-	allHandlers := append(this.middlewares, handlers...)
-	if err := this.router["GET"].AddRouter(url, allHandlers); err != nil {
-		log.Fatalln(err)
+// 把全局中间件、分组中间件和路由的处理函数组合成每个路由的handler链条
+// 第一次请求时会自动调用，也可以在启动服务前手动调用
+// 新的链条整体发布到节点上，正在处理的请求继续使用旧的链条
+func (this *Core) Freeze() {
+	this.freezeLock.Lock()
+	defer this.freezeLock.Unlock()
+
+	//并发的请求可能已经组合好了
+	if !this.dirty.Load() {
+		return
+	}
+	for _, route := range this.routes {
+		handlers := route.Handlers()
+		for _, node := range route.nodes {
+			node.chain.Store(&handlers)
+		}
 	}
+	//链条都发布之后才能清除标记，看到false的请求一定能拿到完整的链条
+	this.dirty.Store(false)
 }
 
-func (this *Core) Post(url string, handlers ...ControllerHandler) {
-	allHandlers := append(this.middlewares, handlers...)
-	if err := this.router["POST"].AddRouter(url, allHandlers); err != nil {
-		log.Fatalln(err)
-	}
+func (this *Core) Get(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodGet, url, handlers...)
 }
 
-func (this *Core) Put(url string, handlers ...ControllerHandler) {
-	allHandlers := append(this.middlewares, handlers...)
-	if err := this.router["PUT"].AddRouter(url, allHandlers); err != nil {
-		log.Fatalln(err)
+func (this *Core) Post(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPost, url, handlers...)
+}
+
+func (this *Core) Put(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPut, url, handlers...)
+}
+
+func (this *Core) Delete(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodDelete, url, handlers...)
+}
+
+func (this *Core) Patch(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPatch, url, handlers...)
+}
+
+func (this *Core) Head(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodHead, url, handlers...)
+}
+
+func (this *Core) Options(url string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodOptions, url, handlers...)
+}
+
+// 注册所有常用请求方法的路由，返回GET方法的路由
+func (this *Core) Any(url string, handlers ...ControllerHandler) *Route {
+	var route *Route
+	for _, method := range anyMethods {
+		if r := this.Handle(method, url, handlers...); route == nil {
+			route = r
+		}
 	}
+	return route
+}
+
+// 注册任意请求方法的路由
+func (this *Core) Handle(method string, url string, handlers ...ControllerHandler) *Route {
+	return this.addRoute(strings.ToUpper(method), url, nil, handlers)
 }
 
-func (this *Core) Delete(url string, handlers ...ControllerHandler) {
-	allHandlers := append(this.middlewares, handlers...)
-	if err := this.router["DELETE"].AddRouter(url, allHandlers); err != nil {
+// 添加路由，handlers只保存路由自己的处理函数，中间件在Freeze时再组合
+func (this *Core) addRoute(method string, url string, group *Group, handlers []ControllerHandler) *Route {
+	router, host := this.router, (*hostRouter)(nil)
+	if group != nil && group.host != nil {
+		host = group.host
+		router = host.router
+	}
+
+	tree, ok := router[method]
+	if !ok {
+		tree = NewTree()
+		tree.ignoreCase = !this.caseSensitive
+		router[method] = tree
+	}
+	nodes, err := tree.addRouter(url, nil)
+	if err != nil {
 		log.Fatalln(err)
 	}
+	if maxParams := tree.maxParams + host.paramCount(); maxParams > this.maxParams {
+		this.maxParams = maxParams
+	}
+	route := &Route{
+		core:     this,
+		group:    group,
+		host:     host.String(),
+		nodes:    nodes,
+		method:   method,
+		path:     cleanRoute(url),
+		handlers: append([]ControllerHandler{}, handlers...),
+	}
+	this.freezeLock.Lock()
+	this.routes = append(this.routes, route)
+	this.dirty.Store(true)
+	this.freezeLock.Unlock()
+	return route
 }
 
 func (this *Core) Group(prefix string) IGroup {
 	return NewGroup(this, prefix)
 }
 
-func (this *Core) FindRouteNode(req *http.Request) *Node {
-	path := strings.ToUpper(req.URL.Path)
-	method := strings.ToUpper(req.Method)
+// 获取注册了这个路径的所有请求方法，按字母排序
+func (this *Core) allowedMethods(router map[string]*Tree, path string, params *Params) []string {
+	mark := len(*params)
+	defer func() { *params = (*params)[:mark] }()
+
+	allow := []string{}
+	hasGet, hasHead := false, false
+	for method, tree := range router {
+		if method == anyMethod {
+			continue
+		}
+		*params = (*params)[:mark]
+		if tree.FindNode(path, params) != nil {
+			allow = append(allow, method)
+			hasGet = hasGet || method == http.MethodGet
+			hasHead = hasHead || method == http.MethodHead
+		}
+	}
+	if len(allow) == 0 {
+		return allow
+	}
+	//GET路由会自动应答HEAD请求
+	if hasGet && !hasHead {
+		allow = append(allow, http.MethodHead)
+	}
+	if this.handleOptions && router[http.MethodOptions].FindNode(path, params) == nil {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+// 查找请求对应的路由节点，host和路径中的参数追加到params中
+func (this *Core) FindRouteNode(req *http.Request, params *Params) *Node {
+	return this.findNode(this.routerFor(req, params), req.Method, req.URL.Path, params)
+}
 
-	if m, ok := this.router[method]; ok {
-		return m.FindNode(path)
+func (this *Core) findNode(router map[string]*Tree, method string, path string, params *Params) *Node {
+	method = strings.ToUpper(method)
+	mark := len(*params)
+	if m, ok := router[method]; ok {
+		if node := m.FindNode(path, params); node != nil {
+			return node
+		}
+	}
+	//没有注册HEAD路由时，使用GET路由应答
+	if method == http.MethodHead {
+		if m, ok := router[http.MethodGet]; ok {
+			if node := m.FindNode(path, params); node != nil {
+				return node
+			}
+		}
+	}
+	//最后使用匹配所有请求方法的路由
+	if m, ok := router[anyMethod]; ok && method != anyMethod {
+		*params = (*params)[:mark]
+		return m.FindNode(path, params)
 	}
 	return nil
 }
@@ -0,0 +1,389 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedirectPath(t *testing.T) {
+	core := NewCore()
+	core.SetRedirectTrailingSlash(true)
+	core.SetRedirectFixedPath(true)
+	core.Get("/aaa/bbb", routeHandler("/aaa/bbb")...)
+	core.Post("/aaa/bbb", routeHandler("/aaa/bbb")...)
+	core.Get("/dir/", routeHandler("/dir/")...)
+	core.Get("/only-get", routeHandler("/only-get")...)
+	core.Get("/x", routeHandler("/x")...)
+	core.Post("/x/", routeHandler("/x/")...)
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"GET", "/aaa/bbb", 200, ""},
+		//多余的/、.和..
+		{"GET", "//aaa/./bbb", 301, "/aaa/bbb"},
+		{"GET", "/aaa/../aaa/bbb", 301, "/aaa/bbb"},
+		{"GET", "/aaa//bbb", 301, "/aaa/bbb"},
+		{"GET", "//aaa/./bbb/", 301, "/aaa/bbb"},
+		//去掉或者加上结尾的/
+		{"GET", "/aaa/bbb/", 301, "/aaa/bbb"},
+		{"GET", "/dir", 301, "/dir/"},
+		//保留查询参数
+		{"GET", "/aaa/bbb/?page=2&size=10", 301, "/aaa/bbb?page=2&size=10"},
+		{"GET", "//aaa/./bbb?q=1", 301, "/aaa/bbb?q=1"},
+		//GET和HEAD以外的请求使用308
+		{"HEAD", "/aaa/bbb/", 301, "/aaa/bbb"},
+		{"POST", "/aaa/bbb/", 308, "/aaa/bbb"},
+		{"POST", "/aaa/../aaa/bbb", 308, "/aaa/bbb"},
+		//当前请求方法有可以重定向的路由时，重定向优先于405
+		{"POST", "/x", 308, "/x/"},
+		//只有其他请求方法的路由时返回405，不重定向
+		{"POST", "/only-get", 405, ""},
+		{"POST", "/only-get/", 404, ""},
+		{"GET", "/missing/", 404, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s code = %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if location := w.Header().Get("Location"); location != tt.location {
+			t.Errorf("%s %s location = %q, want %q", tt.method, tt.path, location, tt.location)
+		}
+	}
+}
+
+func TestRedirectPathDisabled(t *testing.T) {
+	core := NewCore()
+	core.Get("/aaa/bbb", routeHandler("/aaa/bbb")...)
+
+	for _, path := range []string{"/aaa/bbb/", "//aaa/./bbb"} {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s code = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+// 并发的第一次请求和服务过程中的Use都不能看到没有组合好的链条，需要用-race运行
+func TestFreezeConcurrent(t *testing.T) {
+	core := NewCore()
+	core.Use(func(c *Context) error {
+		c.SetHeader("X-Global", "1")
+		return c.Next()
+	})
+	group := core.Group("/api")
+	group.Use(func(c *Context) error {
+		c.SetHeader("X-Group", "1")
+		return c.Next()
+	})
+	group.Get("/users/:id", routeHandler("/api/users/:id")...)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/1", nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := serve()
+			if w.Body.String() != "/api/users/:id" || w.Header().Get("X-Global") != "1" || w.Header().Get("X-Group") != "1" {
+				t.Errorf("incomplete chain: %d %v %q", w.Code, w.Header(), w.Body.String())
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		core.Use(func(c *Context) error {
+			c.SetHeader("X-Late", "1")
+			return c.Next()
+		})
+	}()
+	wg.Wait()
+
+	if w := serve(); w.Header().Get("X-Late") != "1" {
+		t.Errorf("middleware added after serving started is not applied")
+	}
+}
+
+// 精确的host优先于带参数的host，host参数在路径参数之前，都不匹配时使用不区分host的路由
+func TestHostRouting(t *testing.T) {
+	core := NewCore()
+	core.Host("api.example.com").Get("/users", routeHandler("api")...)
+	core.Host(":tenant.example.com").Get("/users", func(c *Context) error {
+		c.Text("tenant " + c.GetParam("tenant"))
+		return nil
+	})
+	core.Host(":tenant.example.com").Get("/items/:id", func(c *Context) error {
+		params := make([]string, 0, len(c.params))
+		for _, p := range c.params {
+			params = append(params, p.Key+"="+p.Value)
+		}
+		c.Text(strings.Join(params, ","))
+		return nil
+	})
+	core.Host(":shop<alpha>.shop.com").Get("/users", func(c *Context) error {
+		c.Text("shop " + c.GetParam("shop"))
+		return nil
+	})
+	core.Get("/users", routeHandler("default")...)
+
+	tests := []struct {
+		host string
+		path string
+		code int
+		body string
+	}{
+		{"api.example.com", "/users", 200, "api"},
+		//host不区分大小写，忽略端口
+		{"API.Example.com:8080", "/users", 200, "api"},
+		{"acme.example.com", "/users", 200, "tenant acme"},
+		{"acme.example.com:8080", "/users", 200, "tenant acme"},
+		{"acme.example.com", "/items/7", 200, "tenant=acme,id=7"},
+		//参数只匹配一段
+		{"a.b.example.com", "/users", 200, "default"},
+		{"example.com", "/users", 200, "default"},
+		{"abc.shop.com", "/users", 200, "shop abc"},
+		{"42.shop.com", "/users", 200, "default"},
+		{"other.com", "/users", 200, "default"},
+		//匹配到的host下没有这个路由时不会再使用其他路由
+		{"api.example.com", "/items/7", 404, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Host = tt.host
+		core.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s%s code = %d, want %d", tt.host, tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s%s body = %q, want %q", tt.host, tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRequestHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"[::1]:8080", "::1"},
+		{"127.0.0.1", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tt.host
+		if got := requestHost(req); got != tt.want {
+			t.Errorf("requestHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// 其他请求方法有这个路由时返回405和Allow头，都没有时返回404
+func TestMethodNotAllowed(t *testing.T) {
+	core := NewCore()
+	core.Get("/users", routeHandler("/users")...)
+	core.Post("/users", routeHandler("/users")...)
+	core.Delete("/users/:id", routeHandler("/users/:id")...)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{"GET", "/users", 200, ""},
+		{"PUT", "/users", 405, "GET, HEAD, POST"},
+		{"GET", "/users/1", 405, "DELETE"},
+		{"PATCH", "/users/1", 405, "DELETE"},
+		{"GET", "/missing", 404, ""},
+		{"DELETE", "/users", 405, "GET, HEAD, POST"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s code = %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s Allow = %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+// 可以替换内置的404和405处理函数，405的处理函数能拿到Allow头
+func TestCustomNotFoundAndMethodNotAllowed(t *testing.T) {
+	core := NewCore()
+	core.Get("/users", routeHandler("/users")...)
+	core.SetNotFound(func(c *Context) error {
+		c.SetStatus(http.StatusNotFound).Text("custom not found")
+		return nil
+	})
+	core.SetMethodNotAllowed(func(c *Context) error {
+		c.SetStatus(http.StatusMethodNotAllowed).Text("allow " + c.GetResponse().Header().Get("Allow"))
+		return nil
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/missing", 404, "custom not found"},
+		{"POST", "/users", 405, "allow GET, HEAD"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+// 各种请求方法的注册，HEAD使用GET路由应答，自动应答OPTIONS
+func TestMethodVerbs(t *testing.T) {
+	core := NewCore()
+	core.SetHandleOptions(true)
+	core.Get("/r", routeHandler("get")...)
+	core.Patch("/r", routeHandler("patch")...)
+	core.Get("/h", routeHandler("get")...)
+	core.Head("/h", routeHandler("head")...)
+	core.Get("/o", routeHandler("get")...)
+	core.Options("/o", routeHandler("options")...)
+	core.Any("/any", routeHandler("any")...)
+	core.Handle("propfind", "/dav", routeHandler("propfind")...)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		allow  string
+	}{
+		{"GET", "/r", 200, "get", ""},
+		{"PATCH", "/r", 200, "patch", ""},
+		//没有注册HEAD路由时使用GET路由
+		{"HEAD", "/r", 200, "get", ""},
+		{"HEAD", "/h", 200, "head", ""},
+		//没有注册OPTIONS路由时自动应答
+		{"OPTIONS", "/r", 204, "", "GET, HEAD, OPTIONS, PATCH"},
+		{"OPTIONS", "/o", 200, "options", ""},
+		{"OPTIONS", "/missing", 404, "", ""},
+		{"GET", "/any", 200, "any", ""},
+		{"POST", "/any", 200, "any", ""},
+		{"PUT", "/any", 200, "any", ""},
+		{"PATCH", "/any", 200, "any", ""},
+		{"DELETE", "/any", 200, "any", ""},
+		{"HEAD", "/any", 200, "any", ""},
+		{"OPTIONS", "/any", 200, "any", ""},
+		{"PROPFIND", "/dav", 200, "propfind", ""},
+		{"GET", "/dav", 405, "", "OPTIONS, PROPFIND"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s code = %d, want %d", tt.method, tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code == 200 && w.Body.String() != tt.body {
+			t.Errorf("%s %s body = %q, want %q", tt.method, tt.path, w.Body.String(), tt.body)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s Allow = %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+// 默认不自动应答OPTIONS，返回405
+func TestOptionsNotHandled(t *testing.T) {
+	core := NewCore()
+	core.Get("/r", routeHandler("get")...)
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/r", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("OPTIONS /r = %d Allow %q, want 405 Allow \"GET, HEAD\"", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+// 默认区分大小写；不区分时只忽略静态段的大小写，参数保持请求中的大小写
+func TestCaseSensitivity(t *testing.T) {
+	newCore := func(sensitive, fixCase bool) *Core {
+		core := NewCore()
+		core.Get("/users/:id", func(c *Context) error {
+			c.Text(c.GetParam("id"))
+			return nil
+		})
+		core.Get("/Docs/*path", func(c *Context) error {
+			c.Text(c.GetParam("path"))
+			return nil
+		})
+		core.Host("api.example.com").Get("/Status", routeHandler("status")...)
+		core.SetCaseSensitive(sensitive)
+		core.SetRedirectFixCase(fixCase)
+		return core
+	}
+
+	tests := []struct {
+		sensitive bool
+		fixCase   bool
+		host      string
+		path      string
+		code      int
+		body      string
+		location  string
+	}{
+		{true, false, "", "/users/AbC", 200, "AbC", ""},
+		{true, false, "", "/USERS/AbC", 404, "", ""},
+		{true, false, "", "/docs/A/b", 404, "", ""},
+		{false, false, "", "/USERS/AbC", 200, "AbC", ""},
+		{false, false, "", "/docs/A/b", 200, "A/b", ""},
+		{false, false, "api.example.com", "/STATUS", 200, "status", ""},
+		//重定向到注册时大小写的路径，参数保持请求中的大小写
+		{false, true, "", "/USERS/AbC", 301, "", "/users/AbC"},
+		{false, true, "", "/docs/A/b", 301, "", "/Docs/A/b"},
+		{false, true, "", "/users/AbC", 200, "AbC", ""},
+		//区分大小写时不会重定向
+		{true, true, "", "/USERS/AbC", 404, "", ""},
+	}
+	for _, tt := range tests {
+		core := newCore(tt.sensitive, tt.fixCase)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		core.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("sensitive=%v fixCase=%v %s code = %d, want %d", tt.sensitive, tt.fixCase, tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code == 200 && w.Body.String() != tt.body {
+			t.Errorf("sensitive=%v fixCase=%v %s body = %q, want %q", tt.sensitive, tt.fixCase, tt.path, w.Body.String(), tt.body)
+		}
+		if location := w.Header().Get("Location"); location != tt.location {
+			t.Errorf("sensitive=%v fixCase=%v %s location = %q, want %q", tt.sensitive, tt.fixCase, tt.path, location, tt.location)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// 可以由handler返回的http错误，Message和Details会返回给客户端，Internal只记录日志
+type HTTPError struct {
+	Code     int         //http状态码
+	Message  string      //返回给客户端的信息
+	Internal error       //内部的错误原因，不会返回给客户端
+	Details  interface{} //返回给客户端的详细信息
+}
+
+// 创建http错误，没有传message时使用状态码对应的文本
+func NewHTTPError(code int, message ...string) *HTTPError {
+	he := &HTTPError{Code: code, Message: http.StatusText(code)}
+	if len(message) > 0 {
+		he.Message = message[0]
+	}
+	return he
+}
+
+func (this *HTTPError) Error() string {
+	if this.Internal != nil {
+		return fmt.Sprintf("code=%d, message=%s, internal=%v", this.Code, this.Message, this.Internal)
+	}
+	return fmt.Sprintf("code=%d, message=%s", this.Code, this.Message)
+}
+
+func (this *HTTPError) Unwrap() error {
+	return this.Internal
+}
+
+// 设置内部的错误原因
+func (this *HTTPError) WithInternal(err error) *HTTPError {
+	this.Internal = err
+	return this
+}
+
+// 设置返回给客户端的详细信息
+func (this *HTTPError) WithDetails(details interface{}) *HTTPError {
+	this.Details = details
+	return this
+}
+
+// 把任意错误转换成http错误，校验错误为422，其他不是http错误的当作500处理，原错误作为内部原因
+func AsHTTPError(err error) *HTTPError {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return validationHTTPError(errs)
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		return validationHTTPError(ValidationErrors{fe})
+	}
+	return NewHTTPError(http.StatusInternalServerError, "server error").WithInternal(err)
+}
+
+// 是否是绑定或者校验失败，原因已经通过Message和Details返回给客户端
+func isInputError(err error) bool {
+	var be *BindError
+	var errs ValidationErrors
+	var fe *FieldError
+	return errors.As(err, &be) || errors.As(err, &errs) || errors.As(err, &fe)
+}
+
+// 处理handler链条返回的错误
+type ErrorHandler func(c *Context, err error)
+
+// 默认的错误处理函数，内部原因记录日志，状态码和信息以problem+json返回给客户端
+// 绑定和校验失败是客户端的输入错误，不记录日志；handler已经写入但还没有输出的body会被丢弃
+func DefaultErrorHandler(c *Context, err error) {
+	c.DiscardBody()
+	he := AsHTTPError(err)
+	if he.Internal != nil && !isInputError(he.Internal) {
+		log.Printf("%s %s error: %v\n", c.Method(), c.Uri(), he.Internal)
+	}
+
+	if !c.IsLegacyErrors() {
+		problem := NewProblem(he.Code, he.Message)
+		problem.Instance = c.req.URL.Path
+		if he.Details != nil {
+			problem.With("details", he.Details)
+		}
+		c.Problem(problem)
+		return
+	}
+
+	if he.Details == nil {
+		c.SetStatus(he.Code).Json(he.Message)
+		return
+	}
+	c.SetStatus(he.Code).Json(map[string]interface{}{
+		"message": he.Message,
+		"details": he.Details,
+	})
+}
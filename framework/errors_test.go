@@ -0,0 +1,183 @@
+package framework
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 外层中间件在Next返回后能看到错误响应的状态码
+func TestErrorRenderedInsideChain(t *testing.T) {
+	core := NewCore()
+	var status, handled int
+	core.SetErrorHandler(func(c *Context, err error) {
+		handled++
+		DefaultErrorHandler(c, err)
+	})
+	core.Use(func(c *Context) error {
+		err := c.Next()
+		status = c.GetResponse().Status()
+		return err
+	})
+	core.Get("/http", func(c *Context) error {
+		return NewHTTPError(http.StatusNotFound)
+	})
+	core.Get("/plain", func(c *Context) error {
+		return errors.New("boom")
+	})
+	//不可比较的错误类型向外层传递时也只处理一次
+	core.Get("/invalid", func(c *Context) error {
+		return ValidationErrors{{Field: "name", Rule: "required", Message: "name is required"}}
+	})
+	core.Get("/field", func(c *Context) error {
+		return &FieldError{Field: "name", Rule: "required", Message: "name is required"}
+	})
+	auth := core.Group("/auth")
+	auth.Use(func(c *Context) error {
+		return c.AbortWithError(http.StatusUnauthorized, errors.New("no token"))
+	})
+	auth.Get("/me", routeHandler("/auth/me")...)
+	//外层中间件把错误换成了另一个错误时，以外层的为准
+	wrap := core.Group("/wrap")
+	wrap.Use(func(c *Context) error {
+		if err := c.Next(); err != nil {
+			return NewHTTPError(http.StatusBadGateway)
+		}
+		return nil
+	})
+	wrap.Get("/x", func(c *Context) error {
+		return NewHTTPError(http.StatusNotFound)
+	})
+
+	tests := []struct {
+		path    string
+		code    int
+		handled int
+	}{
+		{"/http", 404, 1},
+		{"/plain", 500, 1},
+		{"/invalid", 422, 1},
+		{"/field", 422, 1},
+		{"/auth/me", 401, 1},
+		{"/wrap/x", 502, 2},
+	}
+	for _, tt := range tests {
+		status, handled = 0, 0
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code || status != tt.code {
+			t.Errorf("%s code = %d, middleware saw %d, want %d", tt.path, w.Code, status, tt.code)
+		}
+		if handled != tt.handled {
+			t.Errorf("%s error handler called %d times, want %d", tt.path, handled, tt.handled)
+		}
+	}
+}
+
+// handler已经写入但还没有输出的body不能出现在错误响应中
+func TestErrorDiscardsBufferedBody(t *testing.T) {
+	core := NewCore()
+	core.Get("/partial", func(c *Context) error {
+		c.Json(map[string]string{"partial": "1"})
+		return errors.New("boom")
+	})
+	core.Get("/render", func(c *Context) error {
+		c.Text("partial")
+		c.RenderError(http.StatusServiceUnavailable, "busy")
+		return nil
+	})
+	wrap := core.Group("/wrap")
+	wrap.Use(func(c *Context) error {
+		if err := c.Next(); err != nil {
+			return NewHTTPError(http.StatusBadGateway)
+		}
+		return nil
+	})
+	wrap.Get("/x", func(c *Context) error {
+		return NewHTTPError(http.StatusNotFound)
+	})
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/partial", 500},
+		{"/render", 503},
+		{"/wrap/x", 502},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		var problem Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Errorf("%s body %q is not a single problem: %v", tt.path, w.Body.String(), err)
+			continue
+		}
+		if w.Code != tt.code || problem.Status != tt.code {
+			t.Errorf("%s code = %d, problem status = %d, want %d", tt.path, w.Code, problem.Status, tt.code)
+		}
+	}
+}
+
+// 内部原因记录日志，绑定和校验这类客户端的输入错误不记录
+func TestDefaultErrorHandlerLogging(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	core := NewCore()
+	core.Get("/bind", func(c *Context) error {
+		var req struct {
+			Page int `query:"page"`
+		}
+		return c.BindQuery(&req)
+	})
+	core.Get("/validate", func(c *Context) error {
+		var req struct {
+			Page int `query:"page" validate:"min=1"`
+		}
+		return c.BindQuery(&req)
+	})
+	core.Get("/json", func(c *Context) error {
+		var req struct {
+			Page int `json:"page"`
+		}
+		return c.BindJson(&req)
+	})
+	core.Get("/server", func(c *Context) error {
+		return errors.New("db down")
+	})
+	core.Get("/auth", func(c *Context) error {
+		return c.AbortWithError(http.StatusUnauthorized, errors.New("token expired"))
+	})
+
+	tests := []struct {
+		path   string
+		body   string
+		code   int
+		logged bool
+	}{
+		{"/bind?page=x", "", 400, false},
+		{"/validate?page=0", "", 422, false},
+		{"/json", "{", 400, false},
+		{"/server", "", 500, true},
+		{"/auth", "", 401, true},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s code = %d, want %d", tt.path, w.Code, tt.code)
+		}
+		if logged := buf.Len() > 0; logged != tt.logged {
+			t.Errorf("%s logged = %v (%q), want %v", tt.path, logged, buf.String(), tt.logged)
+		}
+	}
+}
@@ -1,16 +1,28 @@
 package framework
 
+import (
+	"net/http"
+	"strings"
+)
+
 type IGroup interface {
-	Get(string, ...ControllerHandler)
-	Post(string, ...ControllerHandler)
-	Put(string, ...ControllerHandler)
-	Delete(string, ...ControllerHandler)
+	Get(string, ...ControllerHandler) *Route
+	Post(string, ...ControllerHandler) *Route
+	Put(string, ...ControllerHandler) *Route
+	Delete(string, ...ControllerHandler) *Route
+	Patch(string, ...ControllerHandler) *Route
+	Head(string, ...ControllerHandler) *Route
+	Options(string, ...ControllerHandler) *Route
+	Any(string, ...ControllerHandler) *Route
+	Handle(string, string, ...ControllerHandler) *Route
+	Mount(string, http.Handler) *Route
 	Use(...ControllerHandler)
 	Group(string) IGroup
 }
 
 type Group struct {
 	core        *Core
+	host        *hostRouter //分组所属的host路由，不区分host的为nil
 	parent      *Group
 	prefix      string
 	middlewares []ControllerHandler
@@ -32,39 +44,68 @@ func (this *Group) GetAbsPrefix() string {
 	return this.parent.GetAbsPrefix() + this.prefix
 }
 
+// 获取分组及所有父分组的中间件，返回新的切片，不会和分组的中间件共享底层数组
 func (this *Group) GetMiddlewares() []ControllerHandler {
 	if this.parent == nil {
-		return this.middlewares
+		return append([]ControllerHandler{}, this.middlewares...)
 	}
 	return append(this.parent.GetMiddlewares(), this.middlewares...)
 }
 
 func (this *Group) Group(uri string) IGroup {
 	group := NewGroup(this.core, uri)
+	group.host = this.host
 	group.parent = this
 	return group
 }
 
-func (this *Group) Get(uri string, handlers ...ControllerHandler) {
-	allHandlers := append(this.GetMiddlewares(), handlers...)
-	this.core.Get(this.GetAbsPrefix()+uri, allHandlers...)
+func (this *Group) Get(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodGet, uri, handlers...)
+}
+
+func (this *Group) Post(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPost, uri, handlers...)
+}
+
+func (this *Group) Put(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPut, uri, handlers...)
+}
+
+func (this *Group) Delete(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodDelete, uri, handlers...)
 }
 
-func (this *Group) Post(uri string, handlers ...ControllerHandler) {
-	allHandlers := append(this.GetMiddlewares(), handlers...)
-	this.core.Post(this.GetAbsPrefix()+uri, allHandlers...)
+func (this *Group) Patch(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodPatch, uri, handlers...)
 }
 
-func (this *Group) Put(uri string, handlers ...ControllerHandler) {
-	allHandlers := append(this.GetMiddlewares(), handlers...)
-	this.core.Put(this.GetAbsPrefix()+uri, allHandlers...)
+func (this *Group) Head(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodHead, uri, handlers...)
 }
 
-func (this *Group) Delete(uri string, handlers ...ControllerHandler) {
-	allHandlers := append(this.GetMiddlewares(), handlers...)
-	this.core.Delete(this.GetAbsPrefix()+uri, allHandlers...)
+func (this *Group) Options(uri string, handlers ...ControllerHandler) *Route {
+	return this.Handle(http.MethodOptions, uri, handlers...)
 }
 
+func (this *Group) Any(uri string, handlers ...ControllerHandler) *Route {
+	var route *Route
+	for _, method := range anyMethods {
+		if r := this.Handle(method, uri, handlers...); route == nil {
+			route = r
+		}
+	}
+	return route
+}
+
+func (this *Group) Handle(method string, uri string, handlers ...ControllerHandler) *Route {
+	return this.core.addRoute(strings.ToUpper(method), this.GetAbsPrefix()+uri, this, handlers)
+}
+
+// 添加分组中间件，对分组及子分组之前和之后注册的路由都生效
 func (this *Group) Use(middlewares ...ControllerHandler) {
+	this.core.freezeLock.Lock()
+	defer this.core.freezeLock.Unlock()
+
 	this.middlewares = append(this.middlewares, middlewares...)
+	this.core.dirty.Store(true)
 }
@@ -0,0 +1,176 @@
+package framework
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 代表一个host下的路由，如 api.example.com 或者 :tenant.example.com
+type hostRouter struct {
+	pattern string
+	labels  []routeToken        //按.拆分后的每一段，:开头的为参数
+	checks  []func(string) bool //参数段的约束检查
+	router  map[string]*Tree    //按请求方法划分的路由
+}
+
+// 解析host规则，参数段和路由中的参数一样以:开头，可以带约束，如 :tenant<alpha>.example.com
+func newHostRouter(pattern string, caseSensitive bool) (*hostRouter, error) {
+	host := &hostRouter{pattern: pattern, router: newRouter(caseSensitive)}
+	for _, label := range strings.Split(pattern, ".") {
+		if label == "" {
+			return nil, errors.New("invalid host: " + pattern)
+		}
+		if !IsWildSegment(label) {
+			host.labels = append(host.labels, routeToken{nType: staticNode, text: label})
+			host.checks = append(host.checks, nil)
+			continue
+		}
+
+		tokens, err := parseRoute("/" + label)
+		if err != nil || len(tokens) != 2 || tokens[1].nType != paramNode || tokens[1].optional {
+			return nil, errors.New("invalid host param " + label + ": " + pattern)
+		}
+		check, err := compileConstraint(tokens[1].constraint)
+		if err != nil {
+			return nil, errors.New(err.Error() + ": " + pattern)
+		}
+		host.labels = append(host.labels, tokens[1])
+		host.checks = append(host.checks, check)
+	}
+	return host, nil
+}
+
+// 获取host路由的分组，在分组上注册的路由只匹配这个host的请求
+// pattern可以是精确的host，也可以带参数，如 :tenant.example.com，参数可以通过Param系列方法获取
+func (this *Core) Host(pattern string) IGroup {
+	host, ok := this.hosts[strings.ToLower(pattern)]
+	if !ok {
+		for _, v := range this.hostPatterns {
+			if v.pattern == pattern {
+				host, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		var err error
+		host, err = newHostRouter(pattern, this.caseSensitive)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if host.paramCount() == 0 {
+			this.hosts[strings.ToLower(pattern)] = host
+		} else {
+			this.hostPatterns = append(this.hostPatterns, host)
+		}
+	}
+
+	group := NewGroup(this, "")
+	group.host = host
+	return group
+}
+
+// 根据请求的host选择路由，host中的参数追加到params中
+// 精确的host优先，然后按注册顺序匹配带参数的host，都不匹配时使用不区分host的路由
+func (this *Core) routerFor(req *http.Request, params *Params) map[string]*Tree {
+	if len(this.hosts) == 0 && len(this.hostPatterns) == 0 {
+		return this.router
+	}
+
+	host := requestHost(req)
+	if v, ok := this.hosts[host]; ok {
+		return v.router
+	}
+	if v, ok := this.hosts[strings.ToLower(host)]; ok {
+		return v.router
+	}
+	for _, v := range this.hostPatterns {
+		if v.match(host, params) {
+			return v.router
+		}
+	}
+	return this.router
+}
+
+// 获取所有的路由，包括各个host的路由
+func (this *Core) routers() []map[string]*Tree {
+	routers := []map[string]*Tree{this.router}
+	for _, v := range this.hosts {
+		routers = append(routers, v.router)
+	}
+	for _, v := range this.hostPatterns {
+		routers = append(routers, v.router)
+	}
+	return routers
+}
+
+// 判断host是否匹配，匹配时把参数追加到params中
+func (this *hostRouter) match(host string, params *Params) bool {
+	mark := len(*params)
+	for i, label := range this.labels {
+		end := strings.IndexByte(host, '.')
+		if i == len(this.labels)-1 {
+			end = len(host)
+		}
+		if end <= 0 {
+			*params = (*params)[:mark]
+			return false
+		}
+
+		value := host[:end]
+		if label.nType == staticNode {
+			if !strings.EqualFold(value, label.text) {
+				*params = (*params)[:mark]
+				return false
+			}
+		} else {
+			if this.checks[i] != nil && !this.checks[i](value) {
+				*params = (*params)[:mark]
+				return false
+			}
+			*params = append(*params, Param{Key: label.text, Value: value})
+		}
+
+		host = host[end:]
+		if i < len(this.labels)-1 {
+			host = host[1:]
+		}
+	}
+	return true
+}
+
+// host中参数的个数
+func (this *hostRouter) paramCount() int {
+	if this == nil {
+		return 0
+	}
+	count := 0
+	for _, label := range this.labels {
+		if label.nType == paramNode {
+			count++
+		}
+	}
+	return count
+}
+
+func (this *hostRouter) String() string {
+	if this == nil {
+		return ""
+	}
+	return this.pattern
+}
+
+// 获取请求的host，去掉端口
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
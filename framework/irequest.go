@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"strconv"
 )
 
@@ -43,10 +44,17 @@ type IRequest interface {
 	FormFile(key string) (*multipart.FileHeader, error)
 	Form(key string) interface{}
 
-	//绑定JSON
+	//绑定JSON，绑定后按validate tag校验
 	BindJson(obj interface{}) error
 	//绑定XML
 	BindXml(obj interface{}) error
+	//按tag绑定uri、query、form、header、cookie中的参数
+	Bind(obj interface{}) error
+	BindUri(obj interface{}) error
+	BindQuery(obj interface{}) error
+	BindForm(obj interface{}) error
+	BindHeader(obj interface{}) error
+	BindCookie(obj interface{}) error
 
 	//获取原始数据
 	GetRawData() ([]byte, error)
@@ -182,12 +190,8 @@ func (c *Context) Query(key string) interface{} {
 }
 
 func (c *Context) GetParam(key string) string {
-	if c.params != nil {
-		if val, ok := c.params[key]; ok {
-			return val
-		}
-	}
-	return ""
+	val, _ := c.params.Get(key)
+	return val
 }
 
 func (c *Context) ParamInt(key string, def int) (int, bool) {
@@ -403,12 +407,12 @@ func (c *Context) BindJson(obj interface{}) error {
 
 		err = json.Unmarshal(all, obj)
 		if err != nil {
-			return err
+			return NewHTTPError(http.StatusBadRequest, "invalid json body").WithInternal(&BindError{Source: "json", Err: err})
 		}
 	} else {
 		return errors.New("request empty")
 	}
-	return nil
+	return validateBound(obj)
 }
 
 func (c *Context) BindXml(obj interface{}) error {
@@ -422,12 +426,12 @@ func (c *Context) BindXml(obj interface{}) error {
 
 		err = xml.Unmarshal(all, obj)
 		if err != nil {
-			return err
+			return NewHTTPError(http.StatusBadRequest, "invalid xml body").WithInternal(&BindError{Source: "xml", Err: err})
 		}
 	} else {
 		return errors.New("request empty")
 	}
-	return nil
+	return validateBound(obj)
 }
 
 func (c *Context) GetRawData() ([]byte, error) {
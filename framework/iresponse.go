@@ -1,12 +1,15 @@
 package framework
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
+	"path/filepath"
 )
 
 type IResponse interface {
@@ -16,6 +19,8 @@ type IResponse interface {
 
 	Xml(obj interface{}) IResponse
 
+	Problem(problem *Problem) IResponse
+
 	Html(file string, obj interface{}) IResponse
 
 	Text(format string, values ...interface{}) IResponse
@@ -24,6 +29,8 @@ type IResponse interface {
 
 	SetHeader(key string, val string) IResponse
 
+	AddHeader(key string, val string) IResponse
+
 	SetCookie(key, val string, maxAge int, path, domain string, secure, httpOnly bool) IResponse
 
 	SetStatus(code int) IResponse
@@ -31,26 +38,76 @@ type IResponse interface {
 	SetOkStatus() IResponse
 }
 
+// 写入body，框架的ResponseWriter会先缓存起来，请求结束时再和状态码、响应头一起写入
+// 所以状态码和响应头可以在body之后设置，如 c.Json(obj).SetStatus(201)
+func (c *Context) writeBody(data []byte) (int, error) {
+	if rw, ok := c.res.(*responseWriter); ok {
+		rw.bufferWrite(data)
+		return len(data), nil
+	}
+	return c.res.Write(data)
+}
+
+// 丢弃handler已经写入但还没有输出的body，输出错误响应前调用，避免错误信息接在部分body后面
+func (c *Context) DiscardBody() {
+	if !c.lockResponse() {
+		return
+	}
+	defer c.resLock.Unlock()
+
+	c.res.DiscardBuffer()
+}
+
+// 以下的方法都需要持有resLock，超时后的写入直接丢弃，避免和超时响应同时写入
+func (c *Context) setHeader(key string, val string) {
+	c.res.Header().Set(key, val)
+}
+
+func (c *Context) setStatus(code int) {
+	c.res.WriteHeader(code)
+}
+
+// 加锁并判断是否超时，超时后返回false，调用方不能再写入响应
+func (c *Context) lockResponse() bool {
+	c.resLock.Lock()
+	if c.isTimeout {
+		c.resLock.Unlock()
+		return false
+	}
+	return true
+}
+
 func (c *Context) Json(obj interface{}) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	json, err := json.Marshal(obj)
 	if err != nil {
-		return c.SetStatus(http.StatusInternalServerError)
+		c.setStatus(http.StatusInternalServerError)
+		return c
 	}
-	c.SetHeader("Content-Type", "application/json")
-	c.res.Write(json)
+	c.setHeader("Content-Type", "application/json")
+	c.writeBody(json)
 	return c
 }
 
 func (c *Context) Jsonp(obj interface{}) IResponse {
 	callbackFunc, _ := c.QueryString("callback", "callback_func")
-	c.SetHeader("Content-Type", "application/javascript")
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
+	c.setHeader("Content-Type", "application/javascript")
 	callbackFunc = template.JSEscapeString(callbackFunc)
 
-	_, err := c.res.Write([]byte(callbackFunc))
+	_, err := c.writeBody([]byte(callbackFunc))
 	if err != nil {
 		return c
 	}
-	_, err = c.res.Write([]byte("("))
+	_, err = c.writeBody([]byte("("))
 	if err != nil {
 		return c
 	}
@@ -58,11 +115,11 @@ func (c *Context) Jsonp(obj interface{}) IResponse {
 	if err != nil {
 		return c
 	}
-	_, err = c.res.Write(json)
+	_, err = c.writeBody(json)
 	if err != nil {
 		return c
 	}
-	_, err = c.res.Write([]byte(")"))
+	_, err = c.writeBody([]byte(")"))
 	if err != nil {
 		return c
 	}
@@ -70,45 +127,121 @@ func (c *Context) Jsonp(obj interface{}) IResponse {
 }
 
 func (c *Context) Xml(obj interface{}) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	xml, err := xml.Marshal(obj)
 	if err != nil {
-		return c.SetStatus(http.StatusInternalServerError)
+		c.setStatus(http.StatusInternalServerError)
+		return c
 	}
-	c.SetHeader("Content-Type", "application/xml")
-	c.res.Write(xml)
+	c.setHeader("Content-Type", "application/xml")
+	c.writeBody(xml)
 	return c
 }
 
-func (c *Context) Html(file string, obj interface{}) IResponse {
-	files, err := template.New("output").ParseFiles(file)
+func (c *Context) Problem(problem *Problem) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
+	json, err := json.Marshal(problem)
 	if err != nil {
+		c.setStatus(http.StatusInternalServerError)
+		return c
+	}
+	c.setHeader("Content-Type", "application/problem+json")
+	if problem.Status != 0 {
+		c.setStatus(problem.Status)
+	}
+	c.writeBody(json)
+	return c
+}
+
+func (c *Context) Html(file string, obj interface{}) IResponse {
+	//模板中可以使用url函数生成命名路由的url
+	funcs := template.FuncMap{
+		"url": func(name string, params ...interface{}) (string, error) {
+			return "", errors.New("route not found: " + name)
+		},
+	}
+	if c.core != nil {
+		funcs = c.core.FuncMap()
+	}
+	//先渲染到缓冲区，渲染失败时不会输出一半的页面
+	var buf bytes.Buffer
+	files, err := template.New(filepath.Base(file)).Funcs(funcs).ParseFiles(file)
+	if err == nil {
+		err = files.Execute(&buf, obj)
+	}
+
+	if !c.lockResponse() {
 		return c
 	}
-	if err := files.Execute(c.res, obj); err != nil {
+	defer c.resLock.Unlock()
+
+	if err != nil {
+		c.setStatus(http.StatusInternalServerError)
 		return c
 	}
-	c.SetHeader("Content-Type", "application/html")
+	c.setHeader("Content-Type", "application/html")
+	c.writeBody(buf.Bytes())
 	return c
 }
 
 func (c *Context) Text(format string, values ...interface{}) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	text := fmt.Sprintf(format, values...)
-	c.SetHeader("Content-Type", "application/text")
-	c.res.Write([]byte(text))
+	c.setHeader("Content-Type", "application/text")
+	c.writeBody([]byte(text))
 	return c
 }
 
 func (c *Context) Redirect(path string) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	http.Redirect(c.res, c.req, path, http.StatusMovedPermanently)
 	return c
 }
 
+// 设置响应头，替换已有的值
 func (c *Context) SetHeader(key string, val string) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
+	c.setHeader(key, val)
+	return c
+}
+
+// 追加响应头，保留已有的值
+func (c *Context) AddHeader(key string, val string) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	c.res.Header().Add(key, val)
 	return c
 }
 
 func (c *Context) SetCookie(key, val string, maxAge int, path, domain string, secure, httpOnly bool) IResponse {
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
 	if path == "" {
 		path = "/"
 	}
@@ -126,11 +259,15 @@ func (c *Context) SetCookie(key, val string, maxAge int, path, domain string, se
 }
 
 func (c *Context) SetStatus(code int) IResponse {
-	c.res.WriteHeader(code)
+	if !c.lockResponse() {
+		return c
+	}
+	defer c.resLock.Unlock()
+
+	c.setStatus(code)
 	return c
 }
 
 func (c *Context) SetOkStatus() IResponse {
-	c.res.WriteHeader(http.StatusOK)
-	return c
+	return c.SetStatus(http.StatusOK)
 }
@@ -1,17 +1,26 @@
 package middlewares
 
-import "github.com/lackone/go-web/framework"
+import (
+	"github.com/lackone/go-web/framework"
+	"log"
+)
 
 func Recovery() framework.ControllerHandler {
 	return func(c *framework.Context) error {
 		defer func() {
 			if err := recover(); err != nil {
-				c.SetStatus(500).Json(err)
+				c.Abort()
+				if c.IsLegacyErrors() {
+					c.DiscardBody()
+					c.SetStatus(500).Json(err)
+					return
+				}
+				//panic的内容只记录日志，不返回给客户端
+				log.Println("panic:", err)
+				c.RenderError(500, "panic")
 			}
 		}()
 
-		c.Next()
-
-		return nil
+		return c.Next()
 	}
 }
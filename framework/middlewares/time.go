@@ -10,12 +10,22 @@ func Time() framework.ControllerHandler {
 	return func(c *framework.Context) error {
 		start := time.Now()
 
-		c.Next()
+		err := c.Next()
 
 		end := time.Since(start)
 
-		log.Printf("%s 用时 %v\n", c.GetRequest().RequestURI, end)
+		res := c.GetResponse()
+		size := res.Size()
+		if size < 0 {
+			size = 0
+		}
 
-		return nil
+		if c.IsAborted() {
+			log.Printf("%s %d %dB 用时 %v，已中止\n", c.GetRequest().RequestURI, res.Status(), size, end)
+		} else {
+			log.Printf("%s %d %dB 用时 %v\n", c.GetRequest().RequestURI, res.Status(), size, end)
+		}
+
+		return err
 	}
 }
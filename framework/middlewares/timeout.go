@@ -1,21 +1,42 @@
 package middlewares
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"github.com/lackone/go-web/framework"
 	"log"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
+// 超时中间件，超时后返回503
 func Timeout(d time.Duration) framework.ControllerHandler {
+	return TimeoutWithHandler(d, DefaultTimeoutHandler)
+}
+
+// 超时中间件，超时后由handler输出响应，handler拿到的是复制的context，可以修改状态码
+// 业务逻辑通过c.Done()或者c.GetRequest().Context()可以感知到超时
+// 超时后业务逻辑还在goroutine中使用context，所以中止handler链条，context也不会被复用
+// 超时由handler输出响应，不会再交给Core的错误处理函数，外层中间件通过c.GetResponse()看到的是超时响应
+func TimeoutWithHandler(d time.Duration, handler framework.ControllerHandler) framework.ControllerHandler {
 	return func(c *framework.Context) error {
-		finishChan := make(chan struct{}, 1)
+		finishChan := make(chan error, 1)
 		panicChan := make(chan interface{}, 1)
 
 		ctx, cancel := context.WithTimeout(c.BaseContext(), d)
 		defer cancel()
 
-		c.GetRequest().WithContext(ctx)
+		//业务逻辑使用带超时的请求，输出先写入缓冲区，超时后丢弃
+		req, res := c.GetRequest(), c.GetResponse()
+		tw := &timeoutWriter{header: http.Header{}}
+		c.SetRequest(req.WithContext(ctx))
+		c.SetResponse(tw)
+		//超时时用来输出响应，在启动goroutine之前复制，避免和业务逻辑竞争
+		tc := c.Copy()
 
 		go func() {
 			defer func() {
@@ -25,22 +46,186 @@ func Timeout(d time.Duration) framework.ControllerHandler {
 			}()
 
 			//执行具体的业务逻辑
-			c.Next()
+			err := c.Next()
 
-			finishChan <- struct{}{}
+			//业务逻辑替换了响应时，把缓存的响应写入缓冲区
+			mux := c.WriterMux()
+			mux.Lock()
+			if !c.GetIsTimeout() {
+				c.GetResponse().WriteHeaderNow()
+			}
+			mux.Unlock()
+
+			finishChan <- err
 		}()
 
 		select {
 		case p := <-panicChan:
 			log.Println(p)
-			c.SetStatus(500).Json("panic")
-		case <-finishChan:
-			log.Println("finish")
+			c.SetRequest(req)
+			c.SetResponse(res)
+			c.Abort()
+			c.RenderError(500, "panic")
+		case err := <-finishChan:
+			c.SetRequest(req)
+			c.SetResponse(res)
+			tw.writeTo(res)
+			return err
 		case <-ctx.Done():
+			//业务逻辑还持有c，c的响应保持为丢弃写入的缓冲区，只通过tc输出超时响应
+			mux := c.WriterMux()
+			mux.Lock()
 			c.SetIsTimeout()
-			c.SetStatus(500).Json("time out")
+			tw.timeout()
+			mux.Unlock()
+			c.Abort()
+
+			tc.SetResponse(res)
+			if err := handler(tc); err != nil {
+				log.Println(err)
+			}
+			tc.GetResponse().WriteHeaderNow()
+			//外层的中间件通过c.GetResponse()看到的是超时响应的状态码和大小
+			tw.finish(res.Status(), res.Size())
 		}
 
 		return nil
 	}
 }
+
+// 默认的超时处理函数，返回503
+func DefaultTimeoutHandler(c *framework.Context) error {
+	c.RenderError(http.StatusServiceUnavailable, "time out")
+	return nil
+}
+
+// 缓存业务逻辑的响应，完成后再写入真正的响应，超时后的写入都会被丢弃
+// 超时后Status和Size返回真正输出的超时响应的状态码和大小
+type timeoutWriter struct {
+	lock     sync.Mutex
+	header   http.Header
+	code     int
+	buf      bytes.Buffer
+	timedOut bool
+	status   int //超时响应的状态码
+	size     int //超时响应的body大小
+}
+
+func (this *timeoutWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *timeoutWriter) Write(data []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return this.buf.Write(data)
+}
+
+// 完成前都只是缓存，可以多次修改状态码
+func (this *timeoutWriter) WriteHeader(code int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.timedOut || code <= 0 {
+		return
+	}
+	this.code = code
+}
+
+func (this *timeoutWriter) Status() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.timedOut {
+		return this.status
+	}
+	if this.code == 0 {
+		return http.StatusOK
+	}
+	return this.code
+}
+
+func (this *timeoutWriter) Size() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.timedOut {
+		return this.size
+	}
+	if this.buf.Len() == 0 {
+		return -1
+	}
+	return this.buf.Len()
+}
+
+// 完成前都没有写入真正的响应，超时后不能再修改
+func (this *timeoutWriter) Written() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.timedOut
+}
+
+// 响应在业务逻辑完成后统一写入，这里不需要处理
+func (this *timeoutWriter) WriteHeaderNow() {
+}
+
+func (this *timeoutWriter) DiscardBuffer() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.buf.Reset()
+}
+
+// 业务逻辑不能绕过缓冲区拿到真正的响应
+func (this *timeoutWriter) Unwrap() http.ResponseWriter {
+	return nil
+}
+
+func (this *timeoutWriter) Flush() {
+}
+
+func (this *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("timeout middleware does not support hijacking")
+}
+
+func (this *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	return http.ErrNotSupported
+}
+
+func (this *timeoutWriter) timeout() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.timedOut = true
+	this.status = http.StatusServiceUnavailable
+	this.size = -1
+	this.buf.Reset()
+}
+
+// 记录真正输出的超时响应
+func (this *timeoutWriter) finish(status int, size int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.status = status
+	this.size = size
+}
+
+// 把缓存的响应头、状态码和body写入真正的响应
+func (this *timeoutWriter) writeTo(res http.ResponseWriter) {
+	dst := res.Header()
+	for k, v := range this.header {
+		dst[k] = v
+	}
+	if this.code != 0 {
+		res.WriteHeader(this.code)
+	}
+	if this.buf.Len() > 0 {
+		res.Write(this.buf.Bytes())
+	}
+}
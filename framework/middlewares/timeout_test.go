@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"github.com/lackone/go-web/framework"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 超时后业务逻辑的写入不能到达客户端，超时也不交给错误处理函数
+// 外层的中间件看到的是真正输出的超时响应
+func TestTimeout(t *testing.T) {
+	core := framework.NewCore()
+	var handled int32
+	core.SetErrorHandler(func(c *framework.Context, err error) {
+		atomic.AddInt32(&handled, 1)
+		framework.DefaultErrorHandler(c, err)
+	})
+	var status, size int
+	core.Use(Recovery(), func(c *framework.Context) error {
+		err := c.Next()
+		status, size = c.GetResponse().Status(), c.GetResponse().Size()
+		return err
+	}, Timeout(20*time.Millisecond))
+
+	done := make(chan struct{})
+	core.Get("/slow", func(c *framework.Context) error {
+		c.Text("partial")
+		<-c.Done()
+		c.GetResponse().Write([]byte("LEAK"))
+		c.Text("LEAK")
+		close(done)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-done
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("code = %d, want 503", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "LEAK") || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("body %q contains writes of the timed out handler", w.Body.String())
+	}
+	if n := atomic.LoadInt32(&handled); n != 0 {
+		t.Errorf("error handler called %d times, want 0", n)
+	}
+	if status != w.Code || size != w.Body.Len() {
+		t.Errorf("middleware saw %d %dB, client got %d %dB", status, size, w.Code, w.Body.Len())
+	}
+}
+
+// 没有超时时响应和不使用Timeout一样
+func TestTimeoutFinished(t *testing.T) {
+	core := framework.NewCore()
+	var status int
+	core.Use(func(c *framework.Context) error {
+		err := c.Next()
+		status = c.GetResponse().Status()
+		return err
+	}, Timeout(time.Second))
+	core.Get("/created", func(c *framework.Context) error {
+		c.Text("ok").SetStatus(http.StatusCreated)
+		return nil
+	})
+	core.Get("/error", func(c *framework.Context) error {
+		c.Text("partial")
+		return framework.NewHTTPError(http.StatusConflict)
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/created", http.StatusCreated, "ok"},
+		{"/error", http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code || status != tt.code {
+			t.Errorf("%s code = %d, middleware saw %d, want %d", tt.path, w.Code, status, tt.code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s body = %q, want %q", tt.path, w.Body.String(), tt.body)
+		}
+		if strings.Contains(w.Body.String(), "partial") {
+			t.Errorf("%s body %q contains the discarded partial body", tt.path, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package framework
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 挂载路由时剩余路径的参数名
+const mountParam = "mountpath"
+
+// 把http.Handler挂载到prefix下，请求路径去掉prefix后交给handler处理
+// 匹配所有的请求方法，包括PROPFIND等扩展方法，同一路径单独注册的方法优先
+// 全局中间件会在handler之前执行，也可以挂载另一个Core作为子应用
+func (this *Core) Mount(prefix string, handler http.Handler) *Route {
+	return this.Handle(anyMethod, mountRoute(prefix), MountHandler(handler))
+}
+
+// 把http.Handler挂载到分组的prefix下，分组的中间件会在handler之前执行
+func (this *Group) Mount(prefix string, handler http.Handler) *Route {
+	return this.Handle(anyMethod, mountRoute(prefix), MountHandler(handler))
+}
+
+// 挂载的路由，如 /debug 得到 /debug/*mountpath，同时也匹配 /debug
+func mountRoute(prefix string) string {
+	return strings.TrimSuffix(cleanRoute(prefix), "/") + "/*" + mountParam
+}
+
+// 把http.Handler转换成ControllerHandler，用于挂载的路由
+// 传给handler的请求是原请求的浅拷贝，路径只保留挂载路由之后的部分
+func MountHandler(handler http.Handler) ControllerHandler {
+	return func(c *Context) error {
+		rest, _ := c.params.Get(mountParam)
+
+		req := new(http.Request)
+		*req = *c.req
+		req.URL = new(url.URL)
+		*req.URL = *c.req.URL
+		req.URL.Path = "/" + rest
+		req.URL.RawPath = ""
+
+		handler.ServeHTTP(c.res, req)
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMountAllMethods(t *testing.T) {
+	core := NewCore()
+	core.Mount("/dav", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dav " + r.Method + " " + r.URL.Path))
+	}))
+	core.Get("/dav/special", routeHandler("/dav/special")...)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/dav/a/b", 200, "dav GET /a/b"},
+		{"PROPFIND", "/dav/a", 200, "dav PROPFIND /a"},
+		{"TRACE", "/dav", 200, "dav TRACE /"},
+		{"MKCOL", "/dav/dir/", 200, "dav MKCOL /dir/"},
+		{"OPTIONS", "/dav/a", 200, "dav OPTIONS /a"},
+		//单独注册的方法优先，其他方法仍然交给挂载的handler
+		{"GET", "/dav/special", 200, "/dav/special"},
+		{"DELETE", "/dav/special", 200, "dav DELETE /special"},
+		{"PROPFIND", "/other", 404, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s code = %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s body = %q, want %q", tt.method, tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package framework
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RFC 7807 定义的错误详情，以 application/problem+json 返回
+type Problem struct {
+	Type       string                 //错误类型的uri，默认为about:blank
+	Title      string                 //错误类型的简短描述
+	Status     int                    //http状态码
+	Detail     string                 //这次错误的具体描述
+	Instance   string                 //出错的请求的uri
+	Extensions map[string]interface{} //扩展字段，和上面的字段平铺在一起输出
+}
+
+// 创建错误详情，标题为状态码对应的文本
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// 设置扩展字段
+func (this *Problem) With(key string, val interface{}) *Problem {
+	if this.Extensions == nil {
+		this.Extensions = map[string]interface{}{}
+	}
+	this.Extensions[key] = val
+	return this
+}
+
+func (this *Problem) MarshalJSON() ([]byte, error) {
+	obj := map[string]interface{}{}
+	for k, v := range this.Extensions {
+		obj[k] = v
+	}
+	if this.Type != "" {
+		obj["type"] = this.Type
+	}
+	if this.Title != "" {
+		obj["title"] = this.Title
+	}
+	if this.Status != 0 {
+		obj["status"] = this.Status
+	}
+	if this.Detail != "" {
+		obj["detail"] = this.Detail
+	}
+	if this.Instance != "" {
+		obj["instance"] = this.Instance
+	}
+	return json.Marshal(obj)
+}
+
+// 是否使用旧的错误格式，即json字符串
+func (c *Context) IsLegacyErrors() bool {
+	return c.core != nil && c.core.legacyErrors
+}
+
+// 输出内置的错误响应，默认为problem+json，Core设置了旧格式时输出json字符串
+// handler已经写入但还没有输出的body会被丢弃
+func (c *Context) RenderError(status int, detail string) IResponse {
+	c.DiscardBody()
+	if c.IsLegacyErrors() {
+		return c.SetStatus(status).Json(detail)
+	}
+	problem := NewProblem(status, detail)
+	problem.Instance = c.req.URL.Path
+	return c.Problem(problem)
+}
@@ -0,0 +1,69 @@
+package framework
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 扩展字段和标准字段平铺输出，空的标准字段不输出，扩展字段不能覆盖标准字段
+func TestProblemMarshalJSON(t *testing.T) {
+	problem := NewProblem(http.StatusConflict, "name taken").With("field", "name").With("status", 200)
+	problem.Instance = "/users"
+	data, err := json.Marshal(problem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"detail":"name taken","field":"name","instance":"/users","status":409,"title":"Conflict","type":"about:blank"}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+
+	data, _ = json.Marshal(&Problem{Status: http.StatusNotFound})
+	if string(data) != `{"status":404}` {
+		t.Errorf("json = %s, want only status", data)
+	}
+}
+
+// 内置的错误响应默认为problem+json，设置了旧格式时为json字符串
+func TestRenderErrorFormats(t *testing.T) {
+	newCore := func(legacy bool) *Core {
+		core := NewCore()
+		core.SetLegacyErrors(legacy)
+		core.Get("/users", routeHandler("/users")...)
+		core.Get("/invalid", func(c *Context) error {
+			return NewHTTPError(http.StatusUnprocessableEntity, "validation failed").WithDetails([]string{"name"})
+		})
+		return core
+	}
+
+	tests := []struct {
+		legacy      bool
+		method      string
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{false, "GET", "/missing", 404, "application/problem+json", `{"detail":"not found","instance":"/missing","status":404,"title":"Not Found","type":"about:blank"}`},
+		{false, "POST", "/users", 405, "application/problem+json", `{"detail":"method not allowed","instance":"/users","status":405,"title":"Method Not Allowed","type":"about:blank"}`},
+		{false, "GET", "/invalid", 422, "application/problem+json", `{"detail":"validation failed","details":["name"],"instance":"/invalid","status":422,"title":"Unprocessable Entity","type":"about:blank"}`},
+		{true, "GET", "/missing", 404, "application/json", `"not found"`},
+		{true, "POST", "/users", 405, "application/json", `"method not allowed"`},
+		{true, "GET", "/invalid", 422, "application/json", `{"details":["name"],"message":"validation failed"}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		newCore(tt.legacy).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("legacy=%v %s %s code = %d, want %d", tt.legacy, tt.method, tt.path, w.Code, tt.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("legacy=%v %s %s Content-Type = %q, want %q", tt.legacy, tt.method, tt.path, ct, tt.contentType)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("legacy=%v %s %s body = %s, want %s", tt.legacy, tt.method, tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
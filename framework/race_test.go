@@ -0,0 +1,6 @@
+//go:build race
+
+package framework
+
+// race模式下sync.Pool会随机丢弃对象，内存分配的测试不准确
+const raceEnabled = true
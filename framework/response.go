@@ -0,0 +1,149 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+const noWritten = -1
+
+// 框架的ResponseWriter，记录状态码、写入的字节数和是否已经写入了响应头
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+
+	//状态码，还没有设置时为200
+	Status() int
+
+	//写入的body字节数，包括还在缓存中的，还没有写入时为-1
+	Size() int
+
+	//是否已经写入了响应头，写入后状态码和响应头都不能再修改
+	Written() bool
+
+	//立即写入响应头和缓存的body，一般在请求结束时调用
+	WriteHeaderNow()
+
+	//丢弃缓存中还没有写入的body，响应头已经写入时不做任何处理
+	DiscardBuffer()
+
+	//获取被包装的http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+	buffer bytes.Buffer //IResponse写入的body，写入响应头时一起写入
+}
+
+// 包装http.ResponseWriter，已经是ResponseWriter时直接返回
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	rw := &responseWriter{}
+	rw.reset(w)
+	return rw
+}
+
+func (this *responseWriter) reset(w http.ResponseWriter) {
+	this.ResponseWriter = w
+	this.status = http.StatusOK
+	this.size = noWritten
+	this.buffer.Reset()
+}
+
+// 只记录状态码，第一次写入body时才真正写入响应头
+// 响应头已经写入后再设置的状态码会被忽略
+func (this *responseWriter) WriteHeader(code int) {
+	if code > 0 && !this.Written() {
+		this.status = code
+	}
+}
+
+// 写入响应头和缓存的body
+func (this *responseWriter) WriteHeaderNow() {
+	if !this.Written() {
+		this.size = 0
+		this.ResponseWriter.WriteHeader(this.status)
+	}
+	if this.buffer.Len() > 0 {
+		n, _ := this.ResponseWriter.Write(this.buffer.Bytes())
+		this.size += n
+		this.buffer.Reset()
+	}
+}
+
+// 缓存body，在请求结束或者Flush时才写入，之前还可以修改状态码和响应头
+func (this *responseWriter) bufferWrite(data []byte) {
+	this.buffer.Write(data)
+}
+
+// 丢弃还没有写入的body，响应头已经写入时body可能已经输出了一部分，保持不变
+func (this *responseWriter) DiscardBuffer() {
+	if !this.Written() {
+		this.buffer.Reset()
+	}
+}
+
+func (this *responseWriter) Write(data []byte) (int, error) {
+	this.WriteHeaderNow()
+	n, err := this.ResponseWriter.Write(data)
+	this.size += n
+	return n, err
+}
+
+func (this *responseWriter) Status() int {
+	return this.status
+}
+
+func (this *responseWriter) Size() int {
+	if this.buffer.Len() == 0 {
+		return this.size
+	}
+	if this.size < 0 {
+		return this.buffer.Len()
+	}
+	return this.size + this.buffer.Len()
+}
+
+func (this *responseWriter) Written() bool {
+	return this.size != noWritten
+}
+
+func (this *responseWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
+
+func (this *responseWriter) Flush() {
+	this.WriteHeaderNow()
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 接管连接后，响应由调用方自己写入
+func (this *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	if this.size < 0 {
+		this.size = 0
+	}
+	return hijacker.Hijack()
+}
+
+func (this *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := this.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,103 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(rec)
+	rw := w.(*responseWriter)
+	if NewResponseWriter(w) != w {
+		t.Errorf("wrapping a ResponseWriter again returns a new writer")
+	}
+	if w.Status() != http.StatusOK || w.Size() != -1 || w.Written() {
+		t.Errorf("new writer = %d %d %v, want 200 -1 false", w.Status(), w.Size(), w.Written())
+	}
+
+	//缓存的body计入Size，状态码还可以修改
+	w.WriteHeader(http.StatusCreated)
+	rw.bufferWrite([]byte("abc"))
+	w.WriteHeader(http.StatusAccepted)
+	if w.Status() != http.StatusAccepted || w.Size() != 3 || w.Written() {
+		t.Errorf("buffered = %d %d %v, want 202 3 false", w.Status(), w.Size(), w.Written())
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("buffered body written before WriteHeaderNow")
+	}
+
+	w.WriteHeaderNow()
+	if !w.Written() || w.Size() != 3 || rec.Code != http.StatusAccepted || rec.Body.String() != "abc" {
+		t.Errorf("after WriteHeaderNow = %v %d, recorder %d %q", w.Written(), w.Size(), rec.Code, rec.Body.String())
+	}
+
+	//写入响应头后状态码不能再修改
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("de"))
+	rw.bufferWrite([]byte("f"))
+	w.DiscardBuffer()
+	if w.Status() != http.StatusAccepted || w.Size() != 6 {
+		t.Errorf("after write = %d %d, want 202 6", w.Status(), w.Size())
+	}
+	w.Flush()
+	if rec.Body.String() != "abcdef" || w.Size() != 6 || !rec.Flushed {
+		t.Errorf("after flush = %q %d %v", rec.Body.String(), w.Size(), rec.Flushed)
+	}
+
+	if _, _, err := w.Hijack(); err == nil {
+		t.Errorf("Hijack on a recorder: want error")
+	}
+	if w.Unwrap() != rec {
+		t.Errorf("Unwrap did not return the original writer")
+	}
+}
+
+// 外层中间件在body输出前就能看到状态码和大小，只设置了状态码时请求结束时写入响应头
+func TestResponseStatusAndSize(t *testing.T) {
+	core := NewCore()
+	var status, size int
+	var written bool
+	core.Use(func(c *Context) error {
+		err := c.Next()
+		res := c.GetResponse()
+		status, size, written = res.Status(), res.Size(), res.Written()
+		return err
+	})
+	core.Get("/json", func(c *Context) error {
+		c.Json(map[string]int{"a": 1}).SetStatus(http.StatusCreated)
+		return nil
+	})
+	core.Get("/empty", func(c *Context) error {
+		c.SetStatus(http.StatusNoContent)
+		return nil
+	})
+	core.Get("/raw", func(c *Context) error {
+		c.GetResponse().WriteHeader(http.StatusAccepted)
+		c.GetResponse().Write([]byte("raw"))
+		return nil
+	})
+
+	tests := []struct {
+		path    string
+		code    int
+		size    int
+		written bool
+		body    string
+	}{
+		{"/json", 201, 7, false, `{"a":1}`},
+		{"/empty", 204, -1, false, ""},
+		{"/raw", 202, 3, true, "raw"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		core.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if status != tt.code || size != tt.size || written != tt.written {
+			t.Errorf("%s middleware saw %d %d %v, want %d %d %v", tt.path, status, size, written, tt.code, tt.size, tt.written)
+		}
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s response = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// 代表一条注册的路由
+type Route struct {
+	core     *Core
+	group    *Group              //注册路由的分组，直接在Core上注册的为nil
+	host     string              //路由所属的host，不区分host的为空
+	nodes    []*Node             //路由在树中对应的节点，有可选参数时有两个
+	method   string              //请求方法
+	path     string              //完整的路由规则
+	name     string              //路由名称，用于反向生成url
+	handlers []ControllerHandler //路由自己的处理函数，不包含中间件
+}
+
+// 给路由命名，名称在Core中必须唯一
+func (this *Route) Name(name string) *Route {
+	if _, ok := this.core.names[name]; ok {
+		log.Fatalln("route name exists: " + name)
+	}
+	this.name = name
+	this.core.names[name] = this
+	return this
+}
+
+func (this *Route) GetName() string {
+	return this.name
+}
+
+func (this *Route) GetMethod() string {
+	return this.method
+}
+
+func (this *Route) GetHost() string {
+	return this.host
+}
+
+func (this *Route) GetPath() string {
+	return this.path
+}
+
+// 获取完整的handler链条：全局中间件 > 分组中间件 > 路由的处理函数
+func (this *Route) Handlers() []ControllerHandler {
+	var groupMiddlewares []ControllerHandler
+	if this.group != nil {
+		groupMiddlewares = this.group.GetMiddlewares()
+	}
+	handlers := make([]ControllerHandler, 0, len(this.core.middlewares)+len(groupMiddlewares)+len(this.handlers))
+	handlers = append(handlers, this.core.middlewares...)
+	handlers = append(handlers, groupMiddlewares...)
+	return append(handlers, this.handlers...)
+}
+
+// 路由信息，用于查看和对比注册的路由
+type RouteInfo struct {
+	Host        string   `json:"host,omitempty"`
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Name        string   `json:"name,omitempty"`
+	Handler     string   `json:"handler"`     //最终的处理函数
+	Middlewares []string `json:"middlewares"` //处理函数之前的中间件
+}
+
+// 获取所有注册的路由，按路径和请求方法排序
+func (this *Core) Routes() []RouteInfo {
+	this.freezeLock.Lock()
+	defer this.freezeLock.Unlock()
+
+	infos := make([]RouteInfo, 0, len(this.routes))
+	for _, route := range this.routes {
+		info := RouteInfo{
+			Host:        route.host,
+			Method:      route.method,
+			Path:        route.path,
+			Name:        route.name,
+			Middlewares: []string{},
+		}
+		handlers := route.Handlers()
+		for i, handler := range handlers {
+			if i == len(handlers)-1 {
+				info.Handler = handlerName(handler)
+			} else {
+				info.Middlewares = append(info.Middlewares, handlerName(handler))
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Host != infos[j].Host {
+			return infos[i].Host < infos[j].Host
+		}
+		if infos[i].Path != infos[j].Path {
+			return infos[i].Path < infos[j].Path
+		}
+		return infos[i].Method < infos[j].Method
+	})
+	return infos
+}
+
+// 输出路由表，可以在启动时打印
+func (this *Core) PrintRoutes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tMETHOD\tPATH\tNAME\tHANDLER\tMIDDLEWARES")
+	for _, info := range this.Routes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Host, info.Method, info.Path, info.Name, info.Handler, strings.Join(info.Middlewares, ","))
+	}
+	tw.Flush()
+}
+
+// 以json输出路由表的处理函数，可以注册成调试接口，如 core.Get("/debug/routes", core.RoutesHandler())
+func (this *Core) RoutesHandler() ControllerHandler {
+	return func(c *Context) error {
+		c.Json(this.Routes())
+		return nil
+	}
+}
+
+// 获取处理函数的名称，中间件返回的闭包使用外层函数的名称，如 middlewares.Recovery
+func handlerName(handler ControllerHandler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	for {
+		i := strings.LastIndex(name, ".func")
+		if i < 0 || strings.Trim(name[i+len(".func"):], "0123456789") != "" {
+			return name
+		}
+		name = name[:i]
+	}
+}
+
+// 根据路由名称生成url，params为参数名和参数值交替的列表，如 URL("user", "id", 42)
+// 参数值会被转义，缺少参数或者多了参数都会返回错误
+func (this *Core) URL(name string, params ...interface{}) (string, error) {
+	route, ok := this.names[name]
+	if !ok {
+		return "", errors.New("route not found: " + name)
+	}
+	if len(params)%2 != 0 {
+		return "", errors.New("params must be key value pairs: " + name)
+	}
+
+	values := map[string]string{}
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("param key must be string: %v", params[i])
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+	return buildURL(route.path, values)
+}
+
+// 生成url，生成失败时panic，适合在注册路由时使用
+func (this *Core) MustURL(name string, params ...interface{}) string {
+	u, err := this.URL(name, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// 模板中可以使用的函数，如 {{url "user" "id" .Id}}
+func (this *Core) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"url": this.URL,
+	}
+}
+
+// 用参数值替换路由规则中的通配符
+func buildURL(path string, values map[string]string) (string, error) {
+	tokens, err := parseRoute(path)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	used := 0
+	for _, token := range tokens {
+		if token.nType == staticNode {
+			b.WriteString(token.text)
+			continue
+		}
+
+		val, ok := values[token.text]
+		if !ok && token.optional {
+			//省略了可选参数，去掉前面的分隔符
+			built := b.String()
+			b.Reset()
+			b.WriteString(built[:len(built)-1])
+			break
+		}
+		if !ok {
+			return "", errors.New("missing param " + token.text + ": " + path)
+		}
+		used++
+
+		if token.nType == catchAllNode {
+			//通配所有段的参数保留/，每一段单独转义
+			segments := strings.Split(val, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+			continue
+		}
+
+		if val == "" {
+			return "", errors.New("empty param " + token.text + ": " + path)
+		}
+		if check, _ := compileConstraint(token.constraint); check != nil && !check(val) {
+			return "", errors.New("param " + token.text + " does not match <" + token.constraint + ">: " + path)
+		}
+		b.WriteString(url.PathEscape(val))
+	}
+	if b.Len() == 0 {
+		b.WriteString("/")
+	}
+
+	if used != len(values) {
+		for key := range values {
+			if !hasRouteParam(tokens, key) {
+				return "", errors.New("unknown param " + key + ": " + path)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func hasRouteParam(tokens []routeToken, key string) bool {
+	for _, token := range tokens {
+		if token.nType != staticNode && token.text == key {
+			return true
+		}
+	}
+	return false
+}
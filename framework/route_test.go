@@ -0,0 +1,70 @@
+package framework
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	core := NewCore()
+	core.Get("/users/:id", routeHandler("/users/:id")...).Name("user")
+	core.Get("/files/*path", routeHandler("/files/*path")...).Name("file")
+	core.Get("/archive/:year/:month?", routeHandler("/archive/:year/:month?")...).Name("archive")
+	core.Get("/n/:id<int>", routeHandler("/n/:id<int>")...).Name("num")
+	core.Get("/f/:name.:ext", routeHandler("/f/:name.:ext")...).Name("asset")
+	core.Get("/:lang?", routeHandler("/:lang?")...).Name("home")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+		err    bool
+	}{
+		{"user", []interface{}{"id", 42}, "/users/42", false},
+		//参数值会被转义
+		{"user", []interface{}{"id", "a b/c"}, "/users/a%20b%2Fc", false},
+		//通配所有段的参数保留/
+		{"file", []interface{}{"path", "a b/c.txt"}, "/files/a%20b/c.txt", false},
+		{"archive", []interface{}{"year", 2024}, "/archive/2024", false},
+		{"archive", []interface{}{"year", 2024, "month", "05"}, "/archive/2024/05", false},
+		{"asset", []interface{}{"name", "a", "ext", "txt"}, "/f/a.txt", false},
+		{"num", []interface{}{"id", -3}, "/n/-3", false},
+		{"home", nil, "/", false},
+		{"home", []interface{}{"lang", "en"}, "/en", false},
+		//缺少参数、多了参数、参数不合法
+		{"user", nil, "", true},
+		{"user", []interface{}{"id", ""}, "", true},
+		{"user", []interface{}{"id", 1, "x", 2}, "", true},
+		{"user", []interface{}{"id"}, "", true},
+		{"user", []interface{}{1, 2}, "", true},
+		{"num", []interface{}{"id", "abc"}, "", true},
+		{"missing", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := core.URL(tt.name, tt.params...)
+		if tt.err {
+			if err == nil {
+				t.Errorf("URL(%s, %v) = %q, want error", tt.name, tt.params, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%s, %v) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestURLFuncMap(t *testing.T) {
+	core := NewCore()
+	core.Get("/users/:id", routeHandler("/users/:id")...).Name("user")
+
+	tpl := template.Must(template.New("").Funcs(core.FuncMap()).Parse(`<a href="{{url "user" "id" .}}">`))
+	var b strings.Builder
+	if err := tpl.Execute(&b, 7); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != `<a href="/users/7">` {
+		t.Errorf("template output = %q", b.String())
+	}
+}
@@ -2,21 +2,69 @@ package framework
 
 import (
 	"errors"
+	"path"
 	"strings"
+	"sync/atomic"
 )
 
-// 代表trie树
+// 代表压缩前缀树(radix tree)
 type Tree struct {
-	root *Node `json:"root"` //根节点
+	root       *Node //根节点
+	ignoreCase bool  //查找时静态段是否忽略大小写
+	maxParams  int   //单条路由中最多的参数个数
 }
 
+// 节点类型
+type nodeType uint8
+
+const (
+	staticNode   nodeType = iota //静态前缀
+	paramNode                    //:参数，匹配一个段
+	catchAllNode                 //*通配，匹配剩余所有段
+)
+
 // 代表节点
 type Node struct {
-	isLast   bool                `json:"is_last"` //表示这个节点是否为最终路由规则
-	segment  string              `json:"segment"` //uri字符串中的某段
-	handlers []ControllerHandler `json:"-"`       //处理的handler
-	childs   []*Node             `json:"childs"`  //节点下的所有子节点
-	parent   *Node               `json:"parent"`  //父给节点
+	nType    nodeType
+	isLast   bool                                //表示这个节点是否为最终路由规则
+	prefix   string                              //静态节点为压缩后的公共前缀(保留注册时的大小写)，参数节点为参数名
+	fullPath string                              //最终路由规则注册时的完整路径
+	handlers []ControllerHandler                 //注册时的handler
+	chain    atomic.Pointer[[]ControllerHandler] //Core组合好中间件后发布的完整handler链条
+	indices  string                              //静态子节点前缀的首字节，与childs一一对应
+	childs   []*Node                             //静态子节点
+	params   []*Node                             //:参数子节点，有约束的优先，同类按注册顺序匹配
+	catchAll *Node                               //*通配子节点
+
+	constraint string            //参数节点的约束
+	check      func(string) bool //参数节点的约束检查，没有约束时为nil
+}
+
+// 获取节点的handler链条，Core组合过中间件时为完整的链条，否则为注册时的handler
+func (this *Node) Handlers() []ControllerHandler {
+	if chain := this.chain.Load(); chain != nil {
+		return *chain
+	}
+	return this.handlers
+}
+
+// 路由匹配中的参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// 参数列表，按在路由中出现的顺序排列
+type Params []Param
+
+// 获取参数的值
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
 }
 
 func NewTree() *Tree {
@@ -26,150 +74,499 @@ func NewTree() *Tree {
 
 func NewNode() *Node {
 	return &Node{
+		nType:    staticNode,
 		isLast:   false,
-		segment:  "",
+		prefix:   "",
 		handlers: []ControllerHandler{},
 		childs:   []*Node{},
 	}
 }
 
-func (this *Tree) AddRouter(uri string, handlers []ControllerHandler) error {
-	root := this.root
-	uri = strings.TrimPrefix(uri, "/")
+// 判断一个segment是否是通用，即以:开头
+func IsWildSegment(segment string) bool {
+	return strings.HasPrefix(segment, ":")
+}
 
-	if root.MatchNode(uri) != nil {
-		return errors.New("route exists: " + uri)
-	}
+// 判断一个segment是否通配剩余所有段，即以*开头
+func IsCatchAllSegment(segment string) bool {
+	return strings.HasPrefix(segment, "*")
+}
 
-	segments := strings.Split(uri, "/")
+// 路由规则拆分出来的一段，静态文本或者通配符
+type routeToken struct {
+	nType      nodeType
+	text       string //静态文本，或者参数名
+	constraint string //参数的约束，如 :id<int> 中的int
+	optional   bool   //可选参数，如 :month?，只能是最后一个
+}
 
-	//遍历每一个段
-	for index, segment := range segments {
-		var objNode *Node //有匹配的子节点
+// 把路由规则拆分成静态文本和通配符
+// :参数可以占据整段，也可以和静态文本组成一段，如 /files/:name.:ext，此时:前面不能是字母、数字或者_
+// 参数名由字母、数字和_组成，后面可以跟约束<...>和表示可选的?
+// *通配必须占据最后一整段
+func parseRoute(uri string) ([]routeToken, error) {
+	tokens := []routeToken{}
+	start := 0
+	for i := 1; i < len(uri); i++ {
+		c := uri[i]
+		if c == '*' && uri[i-1] == '/' {
+			name := uri[i+1:]
+			//通配所有剩余段，只能是最后一段
+			if strings.IndexByte(name, '/') >= 0 {
+				return nil, errors.New("catch-all must be the last segment: " + uri)
+			}
+			if name == "" {
+				return nil, errors.New("wildcard must have a name: " + uri)
+			}
+			if strings.ContainsAny(name, ":*<>?") {
+				return nil, errors.New("invalid catch-all name: " + uri)
+			}
+			if start < i {
+				tokens = append(tokens, routeToken{nType: staticNode, text: uri[start:i]})
+			}
+			tokens = append(tokens, routeToken{nType: catchAllNode, text: name})
+			start = len(uri)
+			break
+		}
+		if c != ':' || isNameChar(uri[i-1]) {
+			continue
+		}
 
-		if !IsWildSegment(segment) {
-			segment = strings.ToUpper(segment)
+		if start < i {
+			tokens = append(tokens, routeToken{nType: staticNode, text: uri[start:i]})
+		} else if len(tokens) > 0 && tokens[len(tokens)-1].nType == paramNode {
+			return nil, errors.New("params must be separated by static text: " + uri)
 		}
 
-		isLast := index == len(segments)-1
+		j := i + 1
+		for j < len(uri) && isNameChar(uri[j]) {
+			j++
+		}
+		token := routeToken{nType: paramNode, text: uri[i+1 : j]}
+		if token.text == "" {
+			return nil, errors.New("wildcard must have a name: " + uri)
+		}
+		//参数的约束写在<>中，如 :id<int>、:slug<[a-z-]+>
+		if j < len(uri) && uri[j] == '<' {
+			end := constraintEnd(uri, j)
+			if end < 0 || end == j+1 {
+				return nil, errors.New("invalid param constraint: " + uri)
+			}
+			token.constraint = uri[j+1 : end]
+			j = end + 1
+		}
+		if j < len(uri) && uri[j] == '?' {
+			token.optional = true
+			j++
+			if j != len(uri) {
+				return nil, errors.New("optional param must be the last: " + uri)
+			}
+		}
+		if j < len(uri) && (uri[j] == ':' || uri[j] == '*') {
+			return nil, errors.New("params must be separated by static text: " + uri)
+		}
+		tokens = append(tokens, token)
+		start = j
+		i = j - 1
+	}
+	if start < len(uri) {
+		tokens = append(tokens, routeToken{nType: staticNode, text: uri[start:]})
+	}
+	return tokens, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// 约束结束的>的位置，约束中可以有成对的<>，没有找到时返回-1
+func constraintEnd(uri string, start int) int {
+	depth := 0
+	for i := start; i < len(uri); i++ {
+		switch uri[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// 去掉最后的可选参数及它前面的分隔符，如 /archive/:year/:month? 得到 /archive/:year
+func withoutOptional(tokens []routeToken) []routeToken {
+	tokens = tokens[:len(tokens)-1]
+	if len(tokens) == 0 || tokens[len(tokens)-1].nType != staticNode {
+		return tokens
+	}
+	last := tokens[len(tokens)-1]
+	last.text = last.text[:len(last.text)-1]
+	tokens = append(tokens[:len(tokens)-1:len(tokens)-1], last)
+	if last.text == "" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		tokens = []routeToken{{nType: staticNode, text: "/"}}
+	}
+	return tokens
+}
+
+// 统一路由规则的格式，以/开头
+func cleanRoute(uri string) string {
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	return uri
+}
+
+func (this *Tree) AddRouter(uri string, handlers []ControllerHandler) error {
+	_, err := this.addRouter(uri, handlers)
+	return err
+}
 
-		nodes := root.FilterChildNodes(segment)
-		//如果有匹配的子节点
-		if len(nodes) > 0 {
-			for _, node := range nodes {
-				if node.segment == segment {
-					objNode = node
-					break
+// 添加路由，返回最终路由规则对应的节点，有可选参数时返回省略和不省略两个节点
+func (this *Tree) addRouter(uri string, handlers []ControllerHandler) ([]*Node, error) {
+	uri = cleanRoute(uri)
+
+	tokens, err := parseRoute(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []*Node{}
+	if tokens[len(tokens)-1].optional {
+		node, err := this.insertTokens(uri, withoutOptional(tokens), handlers)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	node, err := this.insertTokens(uri, tokens, handlers)
+	if err != nil {
+		return nil, err
+	}
+	return append(nodes, node), nil
+}
+
+// 按拆分好的段插入节点，返回最终路由规则对应的节点
+func (this *Tree) insertTokens(uri string, tokens []routeToken, handlers []ControllerHandler) (*Node, error) {
+	cur := this.root
+	params := 0
+	for _, token := range tokens {
+		switch token.nType {
+		case staticNode:
+			cur = cur.insertStatic(token.text)
+		case paramNode:
+			params++
+			var objNode *Node
+			for _, v := range cur.params {
+				if v.prefix == token.text && v.constraint == token.constraint {
+					objNode = v
+					continue
 				}
+				//同一层的参数能匹配相同的值时无法确定优先级，如 :id和:name、:n<uint>和:m<int>
+				if constraintsOverlap(v.constraint, token.constraint) {
+					return nil, errors.New("param " + token.String() + " conflicts with " + v.String() + ": " + uri)
+				}
+			}
+			if objNode == nil {
+				check, err := compileConstraint(token.constraint)
+				if err != nil {
+					return nil, errors.New(err.Error() + ": " + uri)
+				}
+				objNode = &Node{nType: paramNode, prefix: token.text, constraint: token.constraint, check: check}
+				cur.addParamChild(objNode)
+			}
+			cur = objNode
+		case catchAllNode:
+			params++
+			//同一层只能有一个通配所有的节点
+			if cur.catchAll != nil && cur.catchAll.prefix != token.text {
+				return nil, errors.New("catch-all *" + token.text + " conflicts with *" + cur.catchAll.prefix + ": " + uri)
 			}
+			if cur.catchAll == nil {
+				cur.catchAll = &Node{nType: catchAllNode, prefix: token.text}
+			}
+			cur = cur.catchAll
 		}
+	}
 
-		if objNode == nil {
-			cnode := NewNode()
-			cnode.segment = segment
-			if isLast {
-				cnode.isLast = true
-				cnode.handlers = handlers
+	//节点已是最终路由规则，说明路由已存在
+	if cur.isLast {
+		return nil, errors.New("route exists: " + uri)
+	}
+	cur.isLast = true
+	cur.fullPath = uri
+	cur.handlers = handlers
+
+	if params > this.maxParams {
+		this.maxParams = params
+	}
+	return cur, nil
+}
+
+// 添加参数子节点，有约束的排在没有约束的前面
+func (this *Node) addParamChild(child *Node) {
+	index := len(this.params)
+	if child.check != nil {
+		for i, v := range this.params {
+			if v.check == nil {
+				index = i
+				break
 			}
-			//修改父节点指针
-			cnode.parent = root
-			root.childs = append(root.childs, cnode)
-			objNode = cnode
 		}
+	}
+	this.params = append(this.params, nil)
+	copy(this.params[index+1:], this.params[index:])
+	this.params[index] = child
+}
 
-		root = objNode
+func (this *Node) String() string {
+	switch this.nType {
+	case paramNode:
+		return routeToken{nType: paramNode, text: this.prefix, constraint: this.constraint}.String()
+	case catchAllNode:
+		return "*" + this.prefix
 	}
-	return nil
+	return this.prefix
 }
 
-func (this *Tree) FindNode(uri string) *Node {
-	uri = strings.TrimPrefix(uri, "/")
-	node := this.root.MatchNode(uri)
-	if node == nil {
-		return nil
+func (this routeToken) String() string {
+	switch this.nType {
+	case paramNode:
+		s := ":" + this.text
+		if this.constraint != "" {
+			s += "<" + this.constraint + ">"
+		}
+		if this.optional {
+			s += "?"
+		}
+		return s
+	case catchAllNode:
+		return "*" + this.text
 	}
-	return node
+	return this.text
 }
 
-// 判断一个segment是否是通用，即以:开头
-func IsWildSegment(segment string) bool {
-	return strings.HasPrefix(segment, ":")
+// 插入静态文本，公共前缀不同时分裂已有的子节点，返回文本末尾对应的节点
+func (this *Node) insertStatic(text string) *Node {
+	cur := this
+	for text != "" {
+		i := strings.IndexByte(cur.indices, text[0])
+		if i < 0 {
+			child := &Node{nType: staticNode, prefix: text}
+			cur.indices += text[:1]
+			cur.childs = append(cur.childs, child)
+			return child
+		}
+
+		child := cur.childs[i]
+		l := commonPrefix(child.prefix, text)
+		if l < len(child.prefix) {
+			//分裂子节点，公共前缀作为新的父节点
+			split := &Node{
+				nType:   staticNode,
+				prefix:  child.prefix[:l],
+				indices: child.prefix[l : l+1],
+				childs:  []*Node{child},
+			}
+			child.prefix = child.prefix[l:]
+			cur.childs[i] = split
+			child = split
+		}
+		text = text[l:]
+		cur = child
+	}
+	return cur
 }
 
-// 获取所有满足segment规则的子节点
-func (this *Node) FilterChildNodes(segment string) []*Node {
-	if len(this.childs) == 0 {
-		return nil
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// 清理请求路径：合并重复的/，去掉.和..段，保留结尾的/
+func CleanPath(p string) string {
+	if p == "" {
+		return "/"
 	}
-	//如果是通配符，则所有下一层子节点都满足条件
-	if IsWildSegment(segment) {
-		return this.childs
+	if p[0] != '/' {
+		p = "/" + p
 	}
-	nodes := make([]*Node, 0, len(this.childs))
+	cleaned := path.Clean(p)
+	//path.Clean会去掉结尾的/，需要补回来
+	if cleaned != "/" && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// 查找路由，参数追加到params中，params容量足够时不会产生内存分配
+func (this *Tree) FindNode(uri string, params *Params) *Node {
+	return this.matchStatic(this.root, uri, params)
+}
 
-	//遍历子节点，获取满足规则的
-	for _, v := range this.childs {
-		if IsWildSegment(v.segment) {
-			//如果子节点有通配符，则满足条件
-			nodes = append(nodes, v)
-		} else if v.segment == segment {
-			//如果文本完全匹配，也满足条件
-			nodes = append(nodes, v)
+// 匹配静态节点，优先级：静态子节点 > :参数子节点 > *通配子节点
+func (this *Tree) matchStatic(node *Node, path string, params *Params) *Node {
+	prefix := node.prefix
+	if !this.hasPrefix(path, prefix) {
+		//如 /static 匹配 /static/*filepath，通配0个段
+		if node.catchAll != nil && len(path)+1 == len(prefix) && prefix[len(path)] == '/' && this.hasPrefix(path, prefix[:len(path)]) {
+			*params = append(*params, Param{Key: node.catchAll.prefix})
+			return node.catchAll
 		}
+		return nil
 	}
-	return nodes
+	return this.matchChilds(node, path[len(prefix):], params)
 }
 
-func (this *Node) MatchNode(uri string) *Node {
-	//把uri分割成两部分
-	segments := strings.SplitN(uri, "/", 2)
+// 匹配参数节点，参数值为到下一个/之前的内容，不能为空
+func (this *Tree) matchParam(node *Node, path string, params *Params) *Node {
+	end := strings.IndexByte(path, '/')
+	if end < 0 {
+		end = len(path)
+	}
+	if end == 0 {
+		return nil
+	}
 
-	segment := segments[0]
-	if !IsWildSegment(segment) {
-		segment = strings.ToUpper(segment)
+	//参数后面跟着同一段中的静态文本，如 :name.:ext，比参数占据整段更具体，优先匹配
+	//参数值从长到短尝试
+	for k := end - 1; k > 0; k-- {
+		for i := 0; i < len(node.indices); i++ {
+			if node.indices[i] != '/' && this.equalByte(node.indices[i], path[k]) {
+				if found := this.matchParamValue(node, path, k, params); found != nil {
+					return found
+				}
+				break
+			}
+		}
 	}
 
-	nodes := this.FilterChildNodes(segment)
-	//如果没有找到符合规则的子节点，则直接返回
-	if nodes == nil || len(nodes) == 0 {
+	//参数占据整段
+	return this.matchParamValue(node, path, end, params)
+}
+
+// 以path[:end]作为参数值，继续匹配剩余的path
+func (this *Tree) matchParamValue(node *Node, path string, end int, params *Params) *Node {
+	//不满足约束时交给兄弟节点继续匹配
+	if node.check != nil && !node.check(path[:end]) {
 		return nil
 	}
 
-	//如果只有最后一个segment，说明是最后的标记
-	if len(segments) == 1 {
-		for _, v := range nodes {
-			if v.isLast {
-				return v
+	mark := len(*params)
+	*params = append(*params, Param{Key: node.prefix, Value: path[:end]})
+	if found := this.matchChilds(node, path[end:], params); found != nil {
+		return found
+	}
+	*params = (*params)[:mark]
+	return nil
+}
+
+// 在节点的子节点中匹配剩余的path
+func (this *Tree) matchChilds(node *Node, path string, params *Params) *Node {
+	if path == "" {
+		if node.isLast {
+			return node
+		}
+		//如 /static/ 匹配 /static/*filepath，通配0个段
+		if node.catchAll != nil {
+			*params = append(*params, Param{Key: node.catchAll.prefix})
+			return node.catchAll
+		}
+		//如 /static 匹配 /static 节点下 / 子节点的 *filepath，通配0个段
+		if i := strings.IndexByte(node.indices, '/'); i >= 0 {
+			child := node.childs[i]
+			if child.prefix == "/" && child.catchAll != nil {
+				*params = append(*params, Param{Key: child.catchAll.prefix})
+				return child.catchAll
 			}
 		}
 		return nil
 	}
 
-	//如果有2个以上segment，递归每个子节点继续查找
-	for _, v := range nodes {
-		node := v.MatchNode(segments[1])
-		if node != nil {
-			return node
+	for i := 0; i < len(node.indices); i++ {
+		if !this.equalByte(node.indices[i], path[0]) {
+			continue
+		}
+		//忽略大小写时，大写和小写开头的子节点都需要尝试
+		if found := this.matchStatic(node.childs[i], path, params); found != nil {
+			return found
+		}
+	}
+
+	for _, child := range node.params {
+		if found := this.matchParam(child, path, params); found != nil {
+			return found
 		}
 	}
 
+	if node.catchAll != nil {
+		*params = append(*params, Param{Key: node.catchAll.prefix, Value: path})
+		return node.catchAll
+	}
 	return nil
 }
 
-// 解析uri中的参数
-func (this *Node) ParseParamsFromEndNode(uri string) map[string]string {
-	ret := map[string]string{}
-	segments := strings.Split(uri, "/")
-	len := len(segments)
-	cur := this
-	for i := len - 1; i >= 0; i-- {
-		if cur.segment == "" {
-			break
+func (this *Tree) equalByte(a, b byte) bool {
+	if this.ignoreCase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+// 判断path是否以prefix开头
+func (this *Tree) hasPrefix(path, prefix string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	if !this.ignoreCase {
+		return path[:len(prefix)] == prefix
+	}
+	for i := 0; i < len(prefix); i++ {
+		if toLower(path[i]) != toLower(prefix[i]) {
+			return false
 		}
-		if IsWildSegment(cur.segment) {
-			ret[cur.segment[1:]] = segments[i]
+	}
+	return true
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// 用参数值替换路由规则中的通配符，得到注册时大小写的路径
+func canonicalPath(fullPath string, params Params) string {
+	tokens, err := parseRoute(fullPath)
+	if err != nil {
+		return fullPath
+	}
+	var b strings.Builder
+	for _, token := range tokens {
+		if token.nType == staticNode {
+			b.WriteString(token.text)
+			continue
+		}
+		val, ok := params.Get(token.text)
+		if !ok && token.optional {
+			//省略了可选参数，去掉前面的分隔符
+			path := b.String()
+			path = path[:len(path)-1]
+			if path == "" {
+				path = "/"
+			}
+			return path
 		}
-		cur = cur.parent
+		b.WriteString(val)
 	}
-	return ret
+	return b.String()
 }
@@ -0,0 +1,436 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 每条路由用自己的规则作为标识，返回匹配到的路由规则
+func routeHandler(route string) []ControllerHandler {
+	return []ControllerHandler{func(c *Context) error {
+		c.Text(route)
+		return nil
+	}}
+}
+
+func TestTreePrecedence(t *testing.T) {
+	routes := []string{
+		"/users/me",
+		"/users/:id",
+		"/users/*rest",
+		"/a/:x/b",
+		"/a/c/d",
+		"/files/*path",
+		"/files/:name/raw",
+		"/static/index.html",
+	}
+
+	//优先级和注册顺序无关，正序和倒序注册的结果要一样
+	checkTreeMatches(t, routes, []treeMatch{
+		{"/users/me", "/users/me", nil},
+		{"/users/42", "/users/:id", Params{{"id", "42"}}},
+		{"/users/42/posts", "/users/*rest", Params{{"rest", "42/posts"}}},
+		{"/users/me/posts", "/users/*rest", Params{{"rest", "me/posts"}}},
+		{"/a/c/d", "/a/c/d", nil},
+		//静态的c/d不匹配时回溯到参数
+		{"/a/c/b", "/a/:x/b", Params{{"x", "c"}}},
+		{"/a/z/b", "/a/:x/b", Params{{"x", "z"}}},
+		{"/files/a.txt/raw", "/files/:name/raw", Params{{"name", "a.txt"}}},
+		{"/files/a.txt", "/files/*path", Params{{"path", "a.txt"}}},
+		{"/files/a/b/c", "/files/*path", Params{{"path", "a/b/c"}}},
+		{"/static/index.html", "/static/index.html", nil},
+		{"/a/c", "", nil},
+		{"/static/other.html", "", nil},
+	})
+}
+
+// 按正序和倒序注册路由，检查每个路径匹配到的路由规则和参数，route为空表示不匹配
+type treeMatch struct {
+	path   string
+	route  string
+	params Params
+}
+
+func checkTreeMatches(t *testing.T, routes []string, tests []treeMatch) {
+	t.Helper()
+	reverse := make([]string, len(routes))
+	for i, route := range routes {
+		reverse[len(routes)-1-i] = route
+	}
+
+	for name, order := range map[string][]string{"forward": routes, "reverse": reverse} {
+		tree := NewTree()
+		for _, route := range order {
+			if err := tree.AddRouter(route, routeHandler(route)); err != nil {
+				t.Fatalf("%s: add %s: %v", name, route, err)
+			}
+		}
+
+		for _, tt := range tests {
+			params := Params{}
+			node := tree.FindNode(tt.path, &params)
+			if tt.route == "" {
+				if node != nil {
+					t.Errorf("%s: %s matched %s, want no match", name, tt.path, node.fullPath)
+				}
+				continue
+			}
+			if node == nil {
+				t.Errorf("%s: %s matched nothing, want %s", name, tt.path, tt.route)
+				continue
+			}
+			if node.fullPath != tt.route {
+				t.Errorf("%s: %s matched %s, want %s", name, tt.path, node.fullPath, tt.route)
+			}
+			if len(params) != len(tt.params) {
+				t.Errorf("%s: %s params = %v, want %v", name, tt.path, params, tt.params)
+				continue
+			}
+			for i := range params {
+				if params[i] != tt.params[i] {
+					t.Errorf("%s: %s params = %v, want %v", name, tt.path, params, tt.params)
+				}
+			}
+		}
+	}
+}
+
+// 不满足约束时交给兄弟节点继续匹配，都不满足时不匹配
+func TestTreeConstraints(t *testing.T) {
+	routes := []string{
+		"/c/:id<int>",
+		"/c/:slug<[a-z-]+>",
+		"/c/:any",
+		"/u/me",
+		"/u/:id<uuid>",
+		"/n/:id<int>/edit",
+		"/d/:id<int>/x",
+		"/d/:name/y",
+	}
+	checkTreeMatches(t, routes, []treeMatch{
+		{"/c/42", "/c/:id<int>", Params{{"id", "42"}}},
+		{"/c/-7", "/c/:id<int>", Params{{"id", "-7"}}},
+		{"/c/hello-world", "/c/:slug<[a-z-]+>", Params{{"slug", "hello-world"}}},
+		//正则需要匹配整个参数值
+		{"/c/Hello", "/c/:any", Params{{"any", "Hello"}}},
+		{"/c/a_b", "/c/:any", Params{{"any", "a_b"}}},
+		{"/u/me", "/u/me", nil},
+		{"/u/123e4567-e89b-12d3-a456-426614174000", "/u/:id<uuid>", Params{{"id", "123e4567-e89b-12d3-a456-426614174000"}}},
+		{"/u/123", "", nil},
+		{"/n/12/edit", "/n/:id<int>/edit", Params{{"id", "12"}}},
+		{"/n/ab/edit", "", nil},
+		//满足约束但后面的段不匹配时，回溯到没有约束的参数
+		{"/d/12/x", "/d/:id<int>/x", Params{{"id", "12"}}},
+		{"/d/12/y", "/d/:name/y", Params{{"name", "12"}}},
+		{"/d/ab/x", "", nil},
+	})
+}
+
+// 一段中的多个参数和可选的最后一个参数
+func TestTreeEmbeddedAndOptional(t *testing.T) {
+	routes := []string{
+		"/files/:name.:ext",
+		"/files/:name",
+		"/v-:major.:minor/docs",
+		"/archive/:year/:month?",
+		"/:lang?",
+	}
+	checkTreeMatches(t, routes, []treeMatch{
+		{"/files/a.txt", "/files/:name.:ext", Params{{"name", "a"}, {"ext", "txt"}}},
+		//有多个.时参数值从长到短尝试，最后一个.分隔
+		{"/files/a.tar.gz", "/files/:name.:ext", Params{{"name", "a.tar"}, {"ext", "gz"}}},
+		{"/files/a", "/files/:name", Params{{"name", "a"}}},
+		//参数值不能为空，匹配不了时整段作为参数
+		{"/files/.hidden", "/files/:name", Params{{"name", ".hidden"}}},
+		{"/files/a.", "/files/:name", Params{{"name", "a."}}},
+		{"/v-1.2/docs", "/v-:major.:minor/docs", Params{{"major", "1"}, {"minor", "2"}}},
+		{"/v-1.2.3/docs", "/v-:major.:minor/docs", Params{{"major", "1.2"}, {"minor", "3"}}},
+		{"/v-1/docs", "", nil},
+		{"/archive/2024", "/archive/:year/:month?", Params{{"year", "2024"}}},
+		{"/archive/2024/05", "/archive/:year/:month?", Params{{"year", "2024"}, {"month", "05"}}},
+		{"/archive/2024/", "", nil},
+		{"/archive", "/:lang?", Params{{"lang", "archive"}}},
+		//根路径的可选参数
+		{"/", "/:lang?", nil},
+		{"/en", "/:lang?", Params{{"lang", "en"}}},
+		{"/en/x", "", nil},
+	})
+}
+
+// 省略可选参数时去掉它前面的分隔符
+func TestWithoutOptional(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{"/archive/:year/:month?", "/archive/:year"},
+		{"/:x?", "/"},
+		{"/page-:n?", "/page"},
+		{"/a/:b<int>?", "/a"},
+	}
+	for _, tt := range tests {
+		tokens, err := parseRoute(tt.route)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.route, err)
+		}
+		var b strings.Builder
+		for _, token := range withoutOptional(tokens) {
+			b.WriteString(token.String())
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s without optional = %q, want %q", tt.route, b.String(), tt.want)
+		}
+	}
+}
+
+// 不合法的路由规则在注册时报错
+func TestParseRouteErrors(t *testing.T) {
+	routes := []string{
+		"/files/:name:ext",
+		"/files/*path/raw",
+		"/files/*",
+		"/files/:",
+		"/a/:month?/b",
+		"/a/:id<>",
+		"/a/:id<int",
+		"/a/:x*y",
+	}
+	for _, route := range routes {
+		if _, err := parseRoute(route); err == nil {
+			t.Errorf("parse %s: want error", route)
+		}
+	}
+}
+
+func TestTreeConflicts(t *testing.T) {
+	tests := []struct {
+		first, second string
+		conflict      bool
+	}{
+		{"/users/:id", "/users/:name", true},
+		{"/files/*path", "/files/*rest", true},
+		{"/users/me", "/users/me", true},
+		//不是最后一段的参数也会冲突
+		{"/u/:id/a", "/u/:name/a", true},
+		{"/u/:id/a", "/u/:name/b", true},
+		{"/v/:n<uint>", "/v/:m<int>", true},
+		{"/v/:n<int>", "/v/:n<uint>", true},
+		{"/v/:n<alpha>", "/v/:m<alnum>", true},
+		{"/v/:n<int>", "/v/:m<int>", true},
+		{"/files/:name.:ext", "/files/:id", true},
+		//约束不会匹配相同的值，或者有约束的优先于没有约束的
+		{"/v/:n<int>", "/v/:m<alpha>", false},
+		{"/v/:n<uuid>", "/v/:m<alnum>", false},
+		{"/v/:n<int>", "/v/:m", false},
+		{"/v/:n<[a-z]+>", "/v/:m<[0-9]+>", false},
+		{"/u/:id/a", "/u/:id/b", false},
+		{"/files/:name.:ext", "/files/:name", false},
+	}
+	for _, tt := range tests {
+		tree := NewTree()
+		if err := tree.AddRouter(tt.first, routeHandler(tt.first)); err != nil {
+			t.Fatalf("add %s: %v", tt.first, err)
+		}
+		err := tree.AddRouter(tt.second, routeHandler(tt.second))
+		if tt.conflict && err == nil {
+			t.Errorf("add %s after %s: want conflict error", tt.second, tt.first)
+		}
+		if !tt.conflict && err != nil {
+			t.Errorf("add %s after %s: %v", tt.second, tt.first, err)
+		}
+	}
+}
+
+// 原来的trie树实现，只用于和radix树对比性能
+type legacyNode struct {
+	isLast  bool
+	segment string
+	childs  []*legacyNode
+	parent  *legacyNode
+}
+
+func (this *legacyNode) add(uri string) {
+	root := this
+	for _, segment := range strings.Split(strings.TrimPrefix(uri, "/"), "/") {
+		if !IsWildSegment(segment) {
+			segment = strings.ToUpper(segment)
+		}
+		var objNode *legacyNode
+		for _, node := range root.childs {
+			if node.segment == segment {
+				objNode = node
+				break
+			}
+		}
+		if objNode == nil {
+			objNode = &legacyNode{segment: segment, parent: root}
+			root.childs = append(root.childs, objNode)
+		}
+		root = objNode
+	}
+	root.isLast = true
+}
+
+func (this *legacyNode) filterChildNodes(segment string) []*legacyNode {
+	if IsWildSegment(segment) {
+		return this.childs
+	}
+	nodes := make([]*legacyNode, 0, len(this.childs))
+	for _, v := range this.childs {
+		if IsWildSegment(v.segment) || v.segment == segment {
+			nodes = append(nodes, v)
+		}
+	}
+	return nodes
+}
+
+func (this *legacyNode) matchNode(uri string) *legacyNode {
+	segments := strings.SplitN(uri, "/", 2)
+	nodes := this.filterChildNodes(segments[0])
+	if len(segments) == 1 {
+		for _, v := range nodes {
+			if v.isLast {
+				return v
+			}
+		}
+		return nil
+	}
+	for _, v := range nodes {
+		if node := v.matchNode(segments[1]); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+func (this *legacyNode) parseParams(uri string) map[string]string {
+	ret := map[string]string{}
+	segments := strings.Split(uri, "/")
+	cur := this
+	for i := len(segments) - 1; i >= 0 && cur.segment != ""; i-- {
+		if IsWildSegment(cur.segment) {
+			ret[cur.segment[1:]] = segments[i]
+		}
+		cur = cur.parent
+	}
+	return ret
+}
+
+// 和原来的实现一样，查找前先把路径转成大写，找到后再解析参数
+func (this *legacyNode) find(uri string) (*legacyNode, map[string]string) {
+	uri = strings.TrimPrefix(uri, "/")
+	node := this.matchNode(strings.ToUpper(uri))
+	if node == nil {
+		return nil, nil
+	}
+	return node, node.parseParams(uri)
+}
+
+var benchRoutes = []string{
+	"/",
+	"/users",
+	"/users/:id",
+	"/users/:id/posts",
+	"/users/:id/posts/:post",
+	"/users/:id/followers",
+	"/orgs/:org/repos",
+	"/orgs/:org/repos/:repo/issues",
+	"/orgs/:org/repos/:repo/pulls",
+	"/orgs/:org/members",
+	"/search/users",
+	"/search/repos",
+	"/about",
+	"/contact",
+}
+
+var benchPaths = []string{
+	"/users/42/posts/7",
+	"/orgs/acme/repos/web/pulls",
+	"/search/repos",
+	"/about",
+}
+
+func BenchmarkTreeFindNode(b *testing.B) {
+	tree := NewTree()
+	for _, route := range benchRoutes {
+		tree.AddRouter(route, routeHandler(route))
+	}
+	params := make(Params, 0, 4)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		if tree.FindNode(benchPaths[i%len(benchPaths)], &params) == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkLegacyTreeFindNode(b *testing.B) {
+	tree := &legacyNode{}
+	for _, route := range benchRoutes {
+		tree.add(route)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if node, _ := tree.find(benchPaths[i%len(benchPaths)]); node == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+// 不分配内存的ResponseWriter
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (this *nopResponseWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *nopResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (this *nopResponseWriter) WriteHeader(code int) {
+}
+
+func newParamCore() (*Core, *http.Request) {
+	core := NewCore()
+	for _, route := range benchRoutes {
+		core.Get(route, func(c *Context) error {
+			return nil
+		})
+	}
+	return core, httptest.NewRequest("GET", "/orgs/acme/repos/web/pulls", nil)
+}
+
+// 参数路由的查找和处理不能分配内存
+func TestServeHTTPZeroAlloc(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with -race")
+	}
+	core, req := newParamCore()
+	w := &nopResponseWriter{header: http.Header{}}
+	core.ServeHTTP(w, req)
+
+	if allocs := testing.AllocsPerRun(100, func() { core.ServeHTTP(w, req) }); allocs != 0 {
+		t.Errorf("ServeHTTP allocs = %v, want 0", allocs)
+	}
+}
+
+func BenchmarkServeHTTPParam(b *testing.B) {
+	core, req := newParamCore()
+	w := &nopResponseWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		core.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,322 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 一个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`           //客户端使用的字段路径，如 items[0].name
+	Rule    string `json:"rule"`            //没有通过的规则，如 required、min
+	Param   string `json:"param,omitempty"` //规则的参数，如 min=3 中的3
+	Message string `json:"message"`         //返回给客户端的信息
+}
+
+func (this *FieldError) Error() string {
+	return this.Message
+}
+
+// 所有字段的校验错误
+type ValidationErrors []*FieldError
+
+func (this ValidationErrors) Error() string {
+	messages := make([]string, 0, len(this))
+	for _, fe := range this {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// 自定义的校验规则，v已经去掉了指针，param为规则的参数
+type ValidateRule func(v reflect.Value, param string) bool
+
+var (
+	validateRules = map[string]ValidateRule{}
+	regexpCache   sync.Map
+)
+
+// 注册自定义的校验规则，如 RegisterValidateRule("mobile", isMobile) 后可以使用 validate:"mobile"
+func RegisterValidateRule(name string, rule ValidateRule) {
+	validateRules[name] = rule
+}
+
+type validateTag struct {
+	name  string
+	param string
+}
+
+// 按validate tag校验结构体，规则用,分隔，如
+//
+//	type CreateReq struct {
+//		Name  string   `json:"name" validate:"required,min=3,max=20"`
+//		Email string   `json:"email" validate:"omitempty,email"`
+//		Role  string   `json:"role" validate:"oneof=admin user"`
+//		Tags  []string `json:"tags" validate:"max=5,dive,min=1"`
+//		Code  string   `json:"code" validate:"regexp=^[a-z]+$"`
+//	}
+//
+// 零值也会检查所有规则，可选的字段使用omitempty，零值时不检查后面的规则；nil指针只检查required
+// dive后的规则作用于切片的每个元素
+// regexp会使用tag剩下的所有内容，必须放在最后
+// 嵌套的结构体会递归校验，校验失败时返回ValidationErrors，不是结构体时不校验
+// 错误中的字段名优先使用json、query、form等tag的名称，直接返回给handler链条时由错误处理函数输出422
+func Validate(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	if err := validateStruct(v, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// 校验绑定后的结构体，校验失败时返回422的HTTPError，Details为每个字段的错误
+func validateBound(obj interface{}) error {
+	err := Validate(obj)
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return validationHTTPError(errs)
+	}
+	return err
+}
+
+func validationHTTPError(errs ValidationErrors) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, "validation failed").WithInternal(errs).WithDetails(errs)
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		tags, err := parseValidateTag(tag)
+		if err != nil {
+			return errors.New(err.Error() + ": " + prefix + field.Name)
+		}
+		if err := validateValue(v.Field(i), prefix+validateFieldName(field), tags, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 客户端传参使用的tag，校验错误中的字段名优先使用这些tag的名称
+var validateNameTags = []string{"json", "xml", "query", "form", "uri", "header", "cookie"}
+
+// 返回给客户端的字段名，没有tag时使用结构体字段名
+func validateFieldName(field reflect.StructField) string {
+	for _, tag := range validateNameTags {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// 解析validate tag，regexp之后的内容都作为它的参数
+func parseValidateTag(tag string) ([]validateTag, error) {
+	var tags []validateTag
+	for tag != "" {
+		part := tag
+		tag = ""
+		if !strings.HasPrefix(part, "regexp=") {
+			if i := strings.IndexByte(part, ','); i >= 0 {
+				part, tag = part[:i], part[i+1:]
+			}
+		}
+
+		name, param, _ := strings.Cut(part, "=")
+		switch name {
+		case "required", "omitempty", "min", "max", "len", "oneof", "email", "regexp", "dive":
+		default:
+			if _, ok := validateRules[name]; !ok {
+				return nil, errors.New("unknown validate rule " + name)
+			}
+		}
+		tags = append(tags, validateTag{name: name, param: param})
+	}
+	return tags, nil
+}
+
+// 按顺序检查规则，每个字段只返回第一个错误，遇到dive时把剩下的规则用于每个元素
+func validateValue(v reflect.Value, name string, tags []validateTag, errs *ValidationErrors) error {
+	zero := !v.IsValid() || v.IsZero()
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for i, tag := range tags {
+		if tag.name == "required" {
+			if zero {
+				*errs = append(*errs, &FieldError{Field: name, Rule: tag.name, Message: name + " is required"})
+				return nil
+			}
+			continue
+		}
+		if tag.name == "omitempty" {
+			if zero {
+				return nil
+			}
+			continue
+		}
+		//nil指针没有值可以检查
+		if !v.IsValid() || v.Kind() == reflect.Ptr {
+			return nil
+		}
+
+		if tag.name == "dive" {
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return errors.New("dive on non slice field: " + name)
+			}
+			for j := 0; j < v.Len(); j++ {
+				if err := validateValue(v.Index(j), name+"["+strconv.Itoa(j)+"]", tags[i+1:], errs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		ok, err := checkValidateTag(v, tag)
+		if err != nil {
+			return errors.New(err.Error() + ": " + name)
+		}
+		if !ok {
+			*errs = append(*errs, &FieldError{Field: name, Rule: tag.name, Param: tag.param, Message: validateMessage(v, name, tag)})
+			return nil
+		}
+	}
+
+	//嵌套的结构体递归校验
+	if v.Kind() == reflect.Struct && v.Type() != timeType {
+		return validateStruct(v, name+".", errs)
+	}
+	return nil
+}
+
+func checkValidateTag(v reflect.Value, tag validateTag) (bool, error) {
+	switch tag.name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(tag.param, 64)
+		if err != nil {
+			return false, errors.New("invalid param of " + tag.name + ": " + tag.param)
+		}
+		size, ok := validateSize(v)
+		if !ok {
+			return false, errors.New(tag.name + " not supported on " + v.Type().String())
+		}
+		switch tag.name {
+		case "min":
+			return size >= limit, nil
+		case "max":
+			return size <= limit, nil
+		}
+		return size == limit, nil
+	case "oneof":
+		val := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(tag.param) {
+			if val == option {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "email":
+		if v.Kind() != reflect.String {
+			return false, errors.New("email not supported on " + v.Type().String())
+		}
+		addr, err := mail.ParseAddress(v.String())
+		return err == nil && addr.Address == v.String(), nil
+	case "regexp":
+		if v.Kind() != reflect.String {
+			return false, errors.New("regexp not supported on " + v.Type().String())
+		}
+		re, err := compileValidateRegexp(tag.param)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(v.String()), nil
+	}
+	return validateRules[tag.name](v, tag.param), nil
+}
+
+// 字符串为字符数，切片和map为元素个数，数字为数值
+func validateSize(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func validateMessage(v reflect.Value, name string, tag validateTag) string {
+	unit := ""
+	switch v.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch tag.name {
+	case "min":
+		return name + " must be at least " + tag.param + unit
+	case "max":
+		return name + " must be at most " + tag.param + unit
+	case "len":
+		return name + " must be exactly " + tag.param + unit
+	case "oneof":
+		return name + " must be one of [" + tag.param + "]"
+	case "email":
+		return name + " must be a valid email address"
+	case "regexp":
+		return name + " must match " + tag.param
+	}
+	return name + " is invalid"
+}
+
+func compileValidateRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(expr, re)
+	return re, nil
+}
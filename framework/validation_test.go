@@ -0,0 +1,79 @@
+package framework
+
+import (
+	"errors"
+	"testing"
+)
+
+type validatePage struct {
+	Page  int     `validate:"min=1"`
+	Size  *int    `validate:"min=1,max=100"`
+	Email string  `validate:"omitempty,email"`
+	Role  string  `validate:"oneof=admin user"`
+	Name  *string `validate:"required"`
+}
+
+// 零值也要检查规则，只有omitempty和nil指针跳过
+func TestValidateZeroValues(t *testing.T) {
+	zero, name, bad := 0, "tom", "bad"
+	tests := []struct {
+		obj    validatePage
+		fields []string
+	}{
+		{validatePage{Page: 1, Role: "user", Name: &name}, nil},
+		{validatePage{Page: 0, Role: "user", Name: &name}, []string{"Page"}},
+		{validatePage{Page: 1, Size: &zero, Role: "user", Name: &name}, []string{"Size"}},
+		{validatePage{Page: 1, Email: bad, Role: "user", Name: &name}, []string{"Email"}},
+		{validatePage{Page: 1, Name: &name}, []string{"Role"}},
+		{validatePage{}, []string{"Page", "Role", "Name"}},
+	}
+	for i, tt := range tests {
+		err := Validate(&tt.obj)
+		var errs ValidationErrors
+		if err != nil && !errors.As(err, &errs) {
+			t.Fatalf("%d: unexpected error %v", i, err)
+		}
+		if len(errs) != len(tt.fields) {
+			t.Errorf("%d: errors = %v, want fields %v", i, errs, tt.fields)
+			continue
+		}
+		for j, fe := range errs {
+			if fe.Field != tt.fields[j] {
+				t.Errorf("%d: errors = %v, want fields %v", i, errs, tt.fields)
+			}
+		}
+	}
+}
+
+type validateItem struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type validateOrder struct {
+	Page  int            `query:"page" form:"p" validate:"min=1"`
+	Items []validateItem `json:"items,omitempty" validate:"min=1,dive"`
+	Note  string         `json:"-" validate:"required"`
+	Tags  []string       `json:"tags" validate:"dive,min=2"`
+}
+
+// 错误中的字段名使用客户端传参的tag名称
+func TestValidateFieldNames(t *testing.T) {
+	obj := validateOrder{Items: []validateItem{{Name: "a"}, {}}, Tags: []string{"ok", "x"}}
+	err := Validate(&obj)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want ValidationErrors", err)
+	}
+	want := []string{"page", "items[1].name", "Note", "tags[1]"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want fields %v", errs, want)
+	}
+	for i, fe := range errs {
+		if fe.Field != want[i] {
+			t.Errorf("field %d = %q, want %q", i, fe.Field, want[i])
+		}
+	}
+	if errs[0].Message != "page must be at least 1" {
+		t.Errorf("message = %q", errs[0].Message)
+	}
+}
@@ -34,6 +34,9 @@ func main() {
 
 	registerRouter(core)
 
+	//打印路由表
+	core.PrintRoutes(os.Stdout)
+
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: core,
@@ -45,7 +48,7 @@ func main() {
 		}
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	<-quit
 